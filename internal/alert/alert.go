@@ -0,0 +1,173 @@
+// Package alert reports failures to TELEGRAM_ERROR_CHAT_ID. Repeats of the
+// same class of failure are collapsed into one message carrying a counter,
+// and a "recovered" message closes the incident once the dependency works
+// again.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Classes of failure. A Frigate instance has its own class, see Frigate.
+const (
+	S3         = "S3"
+	Telegram   = "Telegram"
+	DeadLetter = "Dead letter queue"
+	ClipGone   = "Missing clips"
+)
+
+// Frigate is the class of failures to reach the Frigate instance name.
+func Frigate(name string) string {
+	if name == "" {
+		return "Frigate"
+	}
+	return "Frigate " + name
+}
+
+type (
+	// incident collects the failures of one class until it recovers.
+	incident struct {
+		count     int
+		since     time.Time
+		lastFail  time.Time
+		lastErr   string
+		messageID int
+		// sent is the count shown by the message, flushing is set while
+		// an update is scheduled.
+		sent     int
+		updated  time.Time
+		flushing bool
+	}
+
+	reporter struct {
+		bot        *bot.Bot
+		chatID     int64
+		digest     time.Duration
+		resetAfter time.Duration
+
+		mu        sync.Mutex
+		incidents map[string]*incident
+	}
+
+	Reporter interface {
+		// Fail records a failure of class. The first one is sent to the
+		// error chat, later ones update its counter at most every
+		// ALERT_DIGEST_INTERVAL.
+		Fail(ctx context.Context, class string, err error)
+		// Recover closes the incident of class, if any, with a "recovered"
+		// message.
+		Recover(ctx context.Context, class string)
+	}
+)
+
+func New(b *bot.Bot) Reporter {
+	cfg := config.New()
+	return &reporter{
+		bot:        b,
+		chatID:     cfg.TelegramErrorChatID,
+		digest:     time.Duration(cfg.AlertDigestInterval) * time.Second,
+		resetAfter: time.Duration(cfg.AlertResetAfter) * time.Second,
+		incidents:  make(map[string]*incident),
+	}
+}
+
+func (r *reporter) Fail(ctx context.Context, class string, err error) {
+	now := time.Now()
+	r.mu.Lock()
+	inc := r.incidents[class]
+	if inc != nil && now.Sub(inc.lastFail) > r.resetAfter {
+		// Quiet for long enough, this is a new incident.
+		inc = nil
+	}
+	if inc == nil {
+		inc = &incident{since: now}
+		r.incidents[class] = inc
+	}
+	inc.count++
+	inc.lastFail = now
+	inc.lastErr = err.Error()
+
+	var wait time.Duration
+	switch {
+	case inc.flushing:
+		r.mu.Unlock()
+		return
+	case inc.count > 1:
+		wait = r.digest - now.Sub(inc.updated)
+	}
+	inc.flushing = true
+	r.mu.Unlock()
+
+	if wait > 0 {
+		time.AfterFunc(wait, func() { r.flush(context.WithoutCancel(ctx), class, inc) })
+		return
+	}
+	r.flush(ctx, class, inc)
+}
+
+// flush sends or updates the message of inc.
+func (r *reporter) flush(ctx context.Context, class string, inc *incident) {
+	r.mu.Lock()
+	if r.incidents[class] != inc {
+		// Recovered or superseded in the meantime.
+		inc.flushing = false
+		r.mu.Unlock()
+		return
+	}
+	text := "⚠️ " + class + ": " + inc.lastErr
+	if inc.count > 1 {
+		text += fmt.Sprintf("\n%d times since %s", inc.count, inc.since.Format(time.DateTime))
+	}
+	messageID, count := inc.messageID, inc.count
+	inc.updated = time.Now()
+	r.mu.Unlock()
+
+	var err error
+	if messageID == 0 {
+		var msg *models.Message
+		msg, err = r.bot.SendMessage(ctx, &bot.SendMessageParams{ChatID: r.chatID, Text: text})
+		if err == nil {
+			messageID = msg.ID
+		}
+	} else {
+		_, err = r.bot.EditMessageText(ctx, &bot.EditMessageTextParams{ChatID: r.chatID, MessageID: messageID, Text: text})
+	}
+	if err != nil {
+		// Not reported further, Telegram itself may be what fails.
+		slog.Error("Failed to report error", "class", class, "err", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inc.messageID = messageID
+	inc.sent = count
+	inc.flushing = false
+	if inc.count > inc.sent && r.incidents[class] == inc {
+		// Failures came in while sending, show them later.
+		inc.flushing = true
+		time.AfterFunc(r.digest, func() { r.flush(context.WithoutCancel(ctx), class, inc) })
+	}
+}
+
+func (r *reporter) Recover(ctx context.Context, class string) {
+	r.mu.Lock()
+	inc := r.incidents[class]
+	delete(r.incidents, class)
+	r.mu.Unlock()
+	if inc == nil {
+		return
+	}
+
+	text := fmt.Sprintf("✅ %s recovered after %s (%d failures)", class, time.Since(inc.since).Round(time.Second), inc.count)
+	if _, err := r.bot.SendMessage(ctx, &bot.SendMessageParams{ChatID: r.chatID, Text: text}); err != nil {
+		slog.Error("Failed to report recovery", "class", class, "err", err)
+	}
+}
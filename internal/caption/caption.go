@@ -0,0 +1,204 @@
+// Package caption renders the captions of the Telegram messages from Go
+// text/template templates, one per stage of an event, in the configured
+// language, time zone and parse mode.
+package caption
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	_ "time/tzdata" // TELEGRAM_TIMEZONE works without the system zoneinfo
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/go-telegram/bot/models"
+)
+
+// Stage is the point of the event lifecycle a caption is for.
+type Stage string
+
+const (
+	// Detected is the snapshot of a new event.
+	Detected Stage = "detected"
+	// Review is the snapshot of a new review segment.
+	Review Stage = "review"
+	// InProgress is the preview sent while the event goes on.
+	InProgress Stage = "in_progress"
+	// Clip is the clip of a finished event or review.
+	Clip Stage = "clip"
+	// Parts is the first part of a clip split in Parts.
+	Parts Stage = "parts"
+	// Link is the message pointing to a clip uploaded to the bucket.
+	Link Stage = "link"
+	// Unavailable is the snapshot sent when Frigate lost the clip.
+	Unavailable Stage = "unavailable"
+	// Export is the recording sent for /export, or the link to it when
+	// Link is set.
+	Export Stage = "export"
+)
+
+var stages = []Stage{Detected, Review, InProgress, Clip, Parts, Link, Unavailable, Export}
+
+type (
+	// Data is what the templates can show.
+	Data struct {
+		Instance string
+		Camera   string
+		Label    string
+		SubLabel string
+		ID       string
+		Score    float64
+		Zones    []string
+		Start    time.Time
+		End      time.Time
+		// Severity and Labels are set for review segments.
+		Severity string
+		Labels   []string
+		// Title is the Detected or Review caption, filled by Render for the
+		// later stages.
+		Title markup
+		Link  string
+		Parts int
+	}
+
+	captions struct {
+		templates map[Stage]*template.Template
+		fallback  map[Stage]*template.Template
+		escaper   escaper
+		loc       *time.Location
+	}
+
+	Captions interface {
+		// Render returns the caption of stage, prefixed with the instance
+		// name when there is one.
+		Render(stage Stage, data Data) string
+		// ParseMode is the parse mode to send the captions with.
+		ParseMode() models.ParseMode
+		// Location is TELEGRAM_TIMEZONE, which captions show times in.
+		Location() *time.Location
+	}
+)
+
+// New reads the templates of TELEGRAM_LANGUAGE, overridden stage by stage by
+// CAPTION_<STAGE>.
+func New() (Captions, error) {
+	cfg := config.New()
+	lang, ok := languages[cfg.TelegramLanguage]
+	if !ok {
+		return nil, fmt.Errorf("unknown TELEGRAM_LANGUAGE %q, use en or pt-BR", cfg.TelegramLanguage)
+	}
+	loc, err := time.LoadLocation(cfg.TelegramTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("TELEGRAM_TIMEZONE: %w", err)
+	}
+	esc, err := newEscaper(models.ParseMode(cfg.TelegramParseMode))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &captions{
+		templates: make(map[Stage]*template.Template),
+		fallback:  make(map[Stage]*template.Template),
+		escaper:   esc,
+		loc:       loc,
+	}
+	funcs := c.funcs(lang, loc)
+	for _, stage := range stages {
+		if c.fallback[stage], err = c.parse(stage, lang.templates[stage], funcs); err != nil {
+			return nil, err
+		}
+		c.templates[stage] = c.fallback[stage]
+		if text, ok := os.LookupEnv("CAPTION_" + strings.ToUpper(string(stage))); ok {
+			if c.templates[stage], err = c.parse(stage, text, funcs); err != nil {
+				return nil, fmt.Errorf("CAPTION_%s: %w", strings.ToUpper(string(stage)), err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func (c *captions) parse(stage Stage, text string, funcs template.FuncMap) (*template.Template, error) {
+	t, err := template.New(string(stage)).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	c.escaper.escapeTree(t.Tree.Root)
+	return t, nil
+}
+
+func (c *captions) funcs(lang language, loc *time.Location) template.FuncMap {
+	tr := func(word string) string {
+		if t, ok := lang.words[word]; ok {
+			return t
+		}
+		return word
+	}
+	return template.FuncMap{
+		"escape": c.escaper.escape,
+		// time formats t in TELEGRAM_TIMEZONE with the layout of the language.
+		"time": func(t time.Time) string { return t.In(loc).Format(lang.layout) },
+		// timef formats t in TELEGRAM_TIMEZONE with a Go layout.
+		"timef": func(layout string, t time.Time) string { return t.In(loc).Format(layout) },
+		// duration is the time from start to end, to the second.
+		"duration": func(start, end time.Time) string { return end.Sub(start).Round(time.Second).String() },
+		// percent shows a 0 to 1 score as a percentage.
+		"percent": func(score float64) string { return fmt.Sprintf("%.0f%%", score*100) },
+		// zones lists the zones, "" when there is none.
+		"zones": func(zones []string) string { return strings.Join(zones, ", ") },
+		// tr translates a Frigate label or severity.
+		"tr": tr,
+		// labels lists translated labels.
+		"labels": func(labels []string) string {
+			out := make([]string, len(labels))
+			for i, l := range labels {
+				out[i] = tr(l)
+			}
+			return strings.Join(out, ", ")
+		},
+		"join":   strings.Join,
+		"bold":   c.escaper.wrap("*", "b"),
+		"italic": c.escaper.wrap("_", "i"),
+		"code":   c.escaper.wrap("`", "code"),
+	}
+}
+
+func (c *captions) Render(stage Stage, data Data) string {
+	if data.Title == "" {
+		title := Detected
+		if data.Severity != "" {
+			title = Review
+		}
+		data.Title = markup(c.body(title, data))
+	}
+	text := c.body(stage, data)
+	if data.Instance != "" {
+		text = string(c.escaper.escape("["+data.Instance+"] ")) + text
+	}
+	return text
+}
+
+// body renders stage, with the built-in template when the configured one
+// fails.
+func (c *captions) body(stage Stage, data Data) string {
+	var sb strings.Builder
+	err := c.templates[stage].Execute(&sb, data)
+	if err == nil {
+		return sb.String()
+	}
+	slog.Error("Failed to render caption, using the built-in one", "stage", stage, "err", err)
+	sb.Reset()
+	if err := c.fallback[stage].Execute(&sb, data); err != nil {
+		return string(c.escaper.escape(data.Camera + " " + data.Label + " " + data.ID))
+	}
+	return sb.String()
+}
+
+func (c *captions) ParseMode() models.ParseMode {
+	return c.escaper.mode
+}
+
+func (c *captions) Location() *time.Location {
+	return c.loc
+}
@@ -0,0 +1,138 @@
+package caption
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCaptions(t *testing.T, env map[string]string) Captions {
+	t.Helper()
+	t.Setenv("TELEGRAM_TIMEZONE", "UTC")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	c, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+var (
+	start = time.Date(2024, 8, 30, 6, 40, 0, 0, time.UTC)
+	event = Data{Camera: "Rua", Label: "person", ID: "1725000010.000001-ghi789", Start: start, End: start.Add(95 * time.Second)}
+)
+
+// TestEnglish checks the built-in templates give the captions sent before
+// they existed.
+func TestEnglish(t *testing.T) {
+	c := newTestCaptions(t, nil)
+	review := Data{Camera: "Rua", Severity: "alert", Labels: []string{"car", "person"}, ID: "1725000000.6-r4nd0m"}
+	tests := []struct {
+		stage Stage
+		data  Data
+		want  string
+	}{
+		{Detected, event, "Rua Event: person, ID: 1725000010.000001-ghi789"},
+		{Review, review, "Rua alert: car, person, ID: 1725000000.6-r4nd0m"},
+		{InProgress, event, "Rua Event: person, in progress"},
+		{Clip, event, "Rua Event: person, ID: 1725000010.000001-ghi789"},
+		{Clip, review, "Rua alert: car, person, ID: 1725000000.6-r4nd0m"},
+		{Parts, Data{Camera: "Rua", Label: "car", ID: "x", Parts: 3}, "Rua Event: car, ID: x (3 parts)"},
+		{Link, Data{Link: "https://example.com/clip.mp4"}, "Ended \n https://example.com/clip.mp4"},
+		{Unavailable, event, "Ended, clip unavailable \nRua Event: person, ID: 1725000010.000001-ghi789"},
+		{Export, event, "Rua Export: 2024-08-30 06:40:00 - 2024-08-30 06:41:35"},
+		{Detected, Data{Instance: "home", Camera: "Rua", Label: "cat", ID: "x"}, "[home] Rua Event: cat, ID: x"},
+	}
+	for _, tt := range tests {
+		if got := c.Render(tt.stage, tt.data); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.stage, got, tt.want)
+		}
+	}
+}
+
+func TestPortuguese(t *testing.T) {
+	c := newTestCaptions(t, map[string]string{"TELEGRAM_LANGUAGE": "pt-BR"})
+	tests := []struct {
+		stage Stage
+		data  Data
+		want  string
+	}{
+		{Detected, event, "Rua Evento: pessoa, ID: 1725000010.000001-ghi789"},
+		{Review, Data{Camera: "Rua", Severity: "detection", Labels: []string{"car", "speech"}, ID: "x"}, "Rua detecção: carro, speech, ID: x"},
+		{Export, event, "Rua Exportação: 30/08/2024 06:40:00 - 30/08/2024 06:41:35"},
+	}
+	for _, tt := range tests {
+		if got := c.Render(tt.stage, tt.data); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.stage, got, tt.want)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	data := Data{Instance: "casa-1", Camera: "front_door", Label: "person", SubLabel: "<Bob> & *Al*", ID: "1.5-a", Parts: 2}
+	tests := []struct {
+		mode  string
+		stage Stage
+		env   string
+		want  string
+	}{
+		{"MarkdownV2", Detected, "", `\[casa\-1\] front\_door Event: person, ID: 1\.5\-a`},
+		{"MarkdownV2", Parts, "", `\[casa\-1\] front\_door Event: person, ID: 1\.5\-a \(2 parts\)`},
+		{"MarkdownV2", Detected, "{{bold .Camera}} - {{italic .SubLabel}}!", `\[casa\-1\] *front\_door* \- _<Bob\> & \*Al\*_\!`},
+		{"HTML", Detected, "", `[casa-1] front_door Event: person, ID: 1.5-a`},
+		{"HTML", Detected, "{{bold .Camera}} & {{code .SubLabel}}", `[casa-1] <b>front_door</b> &amp; <code>&lt;Bob&gt; &amp; *Al*</code>`},
+		{"", Detected, "{{bold .Camera}} {{.SubLabel}}", `[casa-1] front_door <Bob> & *Al*`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+string(tt.stage), func(t *testing.T) {
+			env := map[string]string{"TELEGRAM_PARSE_MODE": tt.mode}
+			if tt.env != "" {
+				env["CAPTION_DETECTED"] = tt.env
+			}
+			c := newTestCaptions(t, env)
+			if got := c.Render(tt.stage, data); got != tt.want {
+				t.Errorf("%q: got %q, want %q", tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverride(t *testing.T) {
+	c := newTestCaptions(t, map[string]string{
+		"CAPTION_DETECTED": "{{.Camera}}: {{tr .Label}} {{percent .Score}}{{with zones .Zones}} in {{.}}{{end}}",
+		// index out of range fails when rendered.
+		"CAPTION_IN_PROGRESS": "{{index .Zones 5}}",
+	})
+	data := Data{Camera: "Rua", Label: "car", Score: 0.914, Zones: []string{"driveway", "street"}}
+	if got, want := c.Render(Detected, data), "Rua: car 91% in driveway, street"; got != want {
+		t.Errorf("override: got %q, want %q", got, want)
+	}
+	if got, want := c.Render(InProgress, data), "Rua Event: car, in progress"; got != want {
+		t.Errorf("fallback: got %q, want %q", got, want)
+	}
+	// The overridden title is shown by the later stages.
+	if got, want := c.Render(Clip, data), "Rua: car 91% in driveway, street"; got != want {
+		t.Errorf("title: got %q, want %q", got, want)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name, value, want string
+	}{
+		{"TELEGRAM_LANGUAGE", "fr", "unknown TELEGRAM_LANGUAGE"},
+		{"TELEGRAM_PARSE_MODE", "Markdown", "unknown parse mode"},
+		{"TELEGRAM_TIMEZONE", "Mars/Olympus", "TELEGRAM_TIMEZONE"},
+		{"CAPTION_CLIP", "{{.Title", "CAPTION_CLIP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.name, tt.value)
+			if _, err := New(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
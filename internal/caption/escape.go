@@ -0,0 +1,92 @@
+package caption
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// markup is text already formatted for the parse mode, which escape leaves
+// alone.
+type markup string
+
+// escaper makes text safe for a Telegram parse mode.
+type escaper struct {
+	mode    models.ParseMode
+	replace *strings.Replacer
+}
+
+func newEscaper(mode models.ParseMode) (escaper, error) {
+	switch mode {
+	case "":
+		return escaper{mode: mode, replace: strings.NewReplacer()}, nil
+	case models.ParseModeMarkdown:
+		pairs := []string{}
+		for _, c := range "\\_*[]()~`>#+-=|{}.!" {
+			pairs = append(pairs, string(c), "\\"+string(c))
+		}
+		return escaper{mode: mode, replace: strings.NewReplacer(pairs...)}, nil
+	case models.ParseModeHTML:
+		return escaper{mode: mode, replace: strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")}, nil
+	default:
+		return escaper{}, fmt.Errorf("unknown parse mode %q, use MarkdownV2, HTML or nothing", mode)
+	}
+}
+
+// escape is appended to every action of the templates.
+func (e escaper) escape(v any) markup {
+	if m, ok := v.(markup); ok {
+		return m
+	}
+	return markup(e.replace.Replace(fmt.Sprint(v)))
+}
+
+// wrap formats v between the markers of mode, e.g. bold.
+func (e escaper) wrap(markdown, htmlTag string) func(v any) markup {
+	return func(v any) markup {
+		text := e.escape(v)
+		switch e.mode {
+		case models.ParseModeMarkdown:
+			return markup(markdown) + text + markup(markdown)
+		case models.ParseModeHTML:
+			return markup("<"+htmlTag+">") + text + markup("</"+htmlTag+">")
+		}
+		return text
+	}
+}
+
+// escapeTree escapes the text of a template and pipes each of its actions
+// into escape, so that neither the translations nor the event data can
+// break the parse mode. Only the markup helpers produce formatting.
+func (e escaper) escapeTree(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			e.escapeTree(c)
+		}
+	case *parse.TextNode:
+		n.Text = []byte(e.replace.Replace(string(n.Text)))
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier("escape").SetPos(n.Pos)},
+			})
+		}
+	case *parse.IfNode:
+		e.escapeTree(n.List)
+		e.escapeTree(n.ElseList)
+	case *parse.RangeNode:
+		e.escapeTree(n.List)
+		e.escapeTree(n.ElseList)
+	case *parse.WithNode:
+		e.escapeTree(n.List)
+		e.escapeTree(n.ElseList)
+	}
+}
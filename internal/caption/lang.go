@@ -0,0 +1,56 @@
+package caption
+
+// language is a built-in translation: the templates of every stage, the
+// layout of {{time}} and the words {{tr}} translates.
+type language struct {
+	layout    string
+	templates map[Stage]string
+	words     map[string]string
+}
+
+var languages = map[string]language{
+	"en": {
+		layout: "2006-01-02 15:04:05",
+		templates: map[Stage]string{
+			Detected:    `{{.Camera}} Event: {{.Label}}, ID: {{.ID}}`,
+			Review:      `{{.Camera}} {{.Severity}}: {{labels .Labels}}, ID: {{.ID}}`,
+			InProgress:  `{{.Camera}} Event: {{.Label}}, in progress`,
+			Clip:        `{{.Title}}`,
+			Parts:       `{{.Title}} ({{.Parts}} parts)`,
+			Link:        "Ended \n {{.Link}}",
+			Unavailable: "Ended, clip unavailable \n{{.Title}}",
+			Export:      "{{.Camera}} Export: {{time .Start}} - {{time .End}}{{if .Link}}\n{{.Link}}{{end}}",
+		},
+	},
+	"pt-BR": {
+		layout: "02/01/2006 15:04:05",
+		templates: map[Stage]string{
+			Detected:    `{{.Camera}} Evento: {{tr .Label}}, ID: {{.ID}}`,
+			Review:      `{{.Camera}} {{tr .Severity}}: {{labels .Labels}}, ID: {{.ID}}`,
+			InProgress:  `{{.Camera}} Evento: {{tr .Label}}, em andamento`,
+			Clip:        `{{.Title}}`,
+			Parts:       `{{.Title}} ({{.Parts}} partes)`,
+			Link:        "Encerrado\n{{.Link}}",
+			Unavailable: "Encerrado, clipe indisponível\n{{.Title}}",
+			Export:      "{{.Camera}} Exportação: {{time .Start}} - {{time .End}}{{if .Link}}\n{{.Link}}{{end}}",
+		},
+		words: map[string]string{
+			"alert":         "alerta",
+			"detection":     "detecção",
+			"person":        "pessoa",
+			"face":          "rosto",
+			"car":           "carro",
+			"truck":         "caminhão",
+			"bus":           "ônibus",
+			"motorcycle":    "moto",
+			"bicycle":       "bicicleta",
+			"boat":          "barco",
+			"dog":           "cachorro",
+			"cat":           "gato",
+			"bird":          "pássaro",
+			"horse":         "cavalo",
+			"package":       "pacote",
+			"license_plate": "placa",
+		},
+	},
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// snapshotKeys are the query parameters of Frigate's snapshot.jpg endpoint
+// that can be configured.
+var snapshotKeys = map[string]bool{
+	"bbox":      true,
+	"crop":      true,
+	"timestamp": true,
+	"h":         true,
+	"quality":   true,
+}
+
+// SnapshotOptions returns the query sent to Frigate's snapshot.jpg endpoint
+// for camera. It is read from FRIGATE_SNAPSHOT_<CAMERA>, falling back to
+// FRIGATE_SNAPSHOT, as "bbox=1,crop=0,timestamp=1,h=720,quality=80".
+// Unknown keys are ignored.
+func (c *Config) SnapshotOptions(camera string) url.Values {
+	opts := url.Values{}
+	for _, pair := range strings.Split(cameraEnv("FRIGATE_SNAPSHOT", camera, c.FrigateSnapshot), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if ok && snapshotKeys[k] {
+			opts.Set(k, strings.TrimSpace(v))
+		}
+	}
+	return opts
+}
+
+// cameraEnv reads the variable <name>_<CAMERA>, falling back to defaultVal.
+func cameraEnv(name, camera, defaultVal string) string {
+	return getEnv(name+"_"+envName(camera), defaultVal)
+}
+
+// PreviewFormat returns the format of the animated preview sent while an
+// event of label on camera is in progress, "gif" or "mp4", or "" when no
+// preview is wanted. The format is read from FRIGATE_PREVIEW_<CAMERA>,
+// falling back to FRIGATE_PREVIEW, and the labels it applies to from
+// FRIGATE_PREVIEW_LABELS_<CAMERA>, falling back to FRIGATE_PREVIEW_LABELS
+// (all labels when empty).
+func (c *Config) PreviewFormat(camera, label string) string {
+	format := cameraEnv("FRIGATE_PREVIEW", camera, c.FrigatePreview)
+	if format != "gif" && format != "mp4" {
+		return ""
+	}
+
+	labels := cameraEnv("FRIGATE_PREVIEW_LABELS", camera, strings.Join(c.FrigatePreviewLabels, ","))
+	if labels == "" {
+		return format
+	}
+	for _, l := range strings.Split(labels, ",") {
+		if strings.TrimSpace(l) == label {
+			return format
+		}
+	}
+	return ""
+}
+
+// OversizeMode returns how clips of camera too big for Telegram are sent:
+// "transcode" re-encodes them to fit, "split" cuts them into a media group
+// and "s3" (the default, and the fallback of the others) uploads them to
+// the bucket. It is read from FRIGATE_OVERSIZE_<CAMERA>, falling back to
+// FRIGATE_OVERSIZE.
+func (c *Config) OversizeMode(camera string) string {
+	switch mode := cameraEnv("FRIGATE_OVERSIZE", camera, c.FrigateOversize); mode {
+	case "transcode", "split":
+		return mode
+	default:
+		return "s3"
+	}
+}
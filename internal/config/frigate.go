@@ -0,0 +1,100 @@
+package config
+
+import (
+	"strings"
+	"unicode"
+)
+
+// FrigateInstance is a Frigate server to take events from, along with where
+// its notifications go.
+type FrigateInstance struct {
+	// Name tells instances apart in queue messages, dedupe keys, S3 keys
+	// and captions. It is empty when FRIGATE_INSTANCES isn't set, which keeps
+	// the keys of single instance deployments unchanged.
+	Name               string
+	URL                string
+	EventLimit         int
+	Auth               string
+	Username           string
+	Password           string
+	Token              string
+	Headers            []string
+	CAFile             string
+	InsecureSkipVerify bool
+	ChatID             int64
+	Threads            map[string]int
+	MQTTURL            string
+	MQTTUsername       string
+	MQTTPassword       string
+	MQTTTopicPrefix    string
+}
+
+// ThreadID returns the forum topic where events of camera are posted.
+// Unknown cameras go to the General topic.
+func (i FrigateInstance) ThreadID(camera string) int {
+	return i.Threads[camera]
+}
+
+// frigateInstances reads the instances listed in FRIGATE_INSTANCES. Every
+// setting of instance "home" is read from FRIGATE_HOME_<SETTING> (e.g.
+// FRIGATE_HOME_URL, FRIGATE_HOME_CHAT_ID, FRIGATE_HOME_THREADS) and defaults
+// to the global FRIGATE_<SETTING>, TELEGRAM_CHAT_ID, TELEGRAM_THREADS or
+// MQTT_<SETTING>.
+func frigateInstances(cfg *Config) []FrigateInstance {
+	names := getEnvAsSlice("FRIGATE_INSTANCES", nil, ",")
+	if len(names) == 0 {
+		return []FrigateInstance{{
+			URL:                cfg.FrigateURL,
+			EventLimit:         cfg.FrigateEventLimit,
+			Auth:               cfg.FrigateAuth,
+			Username:           cfg.FrigateUsername,
+			Password:           cfg.FrigatePassword,
+			Token:              cfg.FrigateToken,
+			Headers:            cfg.FrigateHeaders,
+			CAFile:             cfg.FrigateCAFile,
+			InsecureSkipVerify: cfg.FrigateInsecureSkipVerify,
+			ChatID:             cfg.TelegramChatID,
+			Threads:            cfg.TelegramThreads,
+			MQTTURL:            cfg.MQTTURL,
+			MQTTUsername:       cfg.MQTTUsername,
+			MQTTPassword:       cfg.MQTTPassword,
+			MQTTTopicPrefix:    cfg.MQTTTopicPrefix,
+		}}
+	}
+
+	instances := make([]FrigateInstance, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		prefix := "FRIGATE_" + envName(name) + "_"
+		instances = append(instances, FrigateInstance{
+			Name:               name,
+			URL:                getEnv(prefix+"URL", cfg.FrigateURL),
+			EventLimit:         getEnvAsInt(prefix+"EVENT_LIMIT", cfg.FrigateEventLimit),
+			Auth:               getEnv(prefix+"AUTH", cfg.FrigateAuth),
+			Username:           getEnv(prefix+"USERNAME", cfg.FrigateUsername),
+			Password:           getEnv(prefix+"PASSWORD", cfg.FrigatePassword),
+			Token:              getEnv(prefix+"TOKEN", cfg.FrigateToken),
+			Headers:            getEnvAsSlice(prefix+"HEADERS", cfg.FrigateHeaders, ","),
+			CAFile:             getEnv(prefix+"CA_FILE", cfg.FrigateCAFile),
+			InsecureSkipVerify: getEnvAsBool(prefix+"INSECURE_SKIP_VERIFY", cfg.FrigateInsecureSkipVerify),
+			ChatID:             getEnvAsInt64(prefix+"CHAT_ID", cfg.TelegramChatID),
+			Threads:            getEnvAsIntMap(prefix+"THREADS", cfg.TelegramThreads),
+			MQTTURL:            getEnv(prefix+"MQTT_URL", cfg.MQTTURL),
+			MQTTUsername:       getEnv(prefix+"MQTT_USERNAME", cfg.MQTTUsername),
+			MQTTPassword:       getEnv(prefix+"MQTT_PASSWORD", cfg.MQTTPassword),
+			MQTTTopicPrefix:    getEnv(prefix+"MQTT_TOPIC_PREFIX", cfg.MQTTTopicPrefix),
+		})
+	}
+	return instances
+}
+
+// envName turns an instance name into the form used in variable names:
+// "Beach House" becomes "BEACH_HOUSE".
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
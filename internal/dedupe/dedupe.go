@@ -0,0 +1,37 @@
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	redis "github.com/redis/go-redis/v9"
+)
+
+type (
+	// Store remembers which events were already notified.
+	Store interface {
+		// SeenOrMark atomically marks eventID as seen and reports whether it
+		// had already been marked. On error the caller can't know either way.
+		SeenOrMark(ctx context.Context, eventID string) (bool, error)
+		Close() error
+	}
+)
+
+// New returns the store selected by cfg.DedupeBackend. rdb is only used by the
+// redis backend.
+func New(rdb *redis.Client) (Store, error) {
+	cfg := config.New()
+	ttl := time.Duration(cfg.DedupeTTL) * time.Second
+	switch cfg.DedupeBackend {
+	case "redis", "":
+		return NewRedis(rdb, ttl), nil
+	case "memory":
+		return NewMemory(cfg.DedupeSize, ttl), nil
+	case "disk":
+		return NewDisk(cfg.DedupePath, ttl)
+	default:
+		return nil, fmt.Errorf("unknown dedupe backend %q", cfg.DedupeBackend)
+	}
+}
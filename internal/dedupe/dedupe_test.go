@@ -0,0 +1,57 @@
+package dedupe
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T, ttl time.Duration) Store{
+		"memory": func(t *testing.T, ttl time.Duration) Store { return NewMemory(10, ttl) },
+		"disk": func(t *testing.T, ttl time.Duration) Store {
+			s, err := NewDisk(filepath.Join(t.TempDir(), "dedupe.db"), ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open(t, time.Hour)
+			defer s.Close()
+
+			for i, want := range []bool{false, true, true} {
+				seen, err := s.SeenOrMark(ctx, "a")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if seen != want {
+					t.Errorf("call %d: seen %v, want %v", i+1, seen, want)
+				}
+			}
+			if seen, _ := s.SeenOrMark(ctx, "b"); seen {
+				t.Error("b seen before it was marked")
+			}
+		})
+	}
+}
+
+func TestDiskExpiry(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewDisk(filepath.Join(t.TempDir(), "dedupe.db"), -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Marks expire at once, so the event is new every time.
+	for i := range 2 {
+		if seen, err := s.SeenOrMark(ctx, "a"); err != nil || seen {
+			t.Errorf("call %d: seen %v, %v", i+1, seen, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package dedupe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var seenBucket = []byte("seen")
+
+type diskStore struct {
+	db   *bolt.DB
+	ttl  time.Duration
+	done chan struct{}
+}
+
+// NewDisk returns a Store persisted in a bbolt file at path. Expired entries
+// are swept every hour.
+func NewDisk(path string, ttl time.Duration) (Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dedupe store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(seenBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize dedupe store: %w", err)
+	}
+
+	d := &diskStore{db: db, ttl: ttl, done: make(chan struct{})}
+	go d.sweep()
+	return d, nil
+}
+
+// SeenOrMark implements Store. Events in progress are checked on every poll,
+// so a read-only transaction answers for the ones already seen and only new
+// events pay for the write and its fsync.
+func (d *diskStore) SeenOrMark(ctx context.Context, eventID string) (bool, error) {
+	seen := false
+	now := time.Now()
+	err := d.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(seenBucket).Get([]byte(eventID)); v != nil && now.Before(expiry(v)) {
+			seen = true
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check event %s: %w", eventID, err)
+	}
+	if seen {
+		return true, nil
+	}
+
+	// Another poller may have marked it in between, check again.
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(seenBucket)
+		if v := b.Get([]byte(eventID)); v != nil && now.Before(expiry(v)) {
+			seen = true
+			return nil
+		}
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(now.Add(d.ttl).Unix()))
+		return b.Put([]byte(eventID), v)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to mark event %s: %w", eventID, err)
+	}
+	return seen, nil
+}
+
+func (d *diskStore) sweep() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		err := d.db.Update(func(tx *bolt.Tx) error {
+			c := tx.Bucket(seenBucket).Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if !now.Before(expiry(v)) {
+					if err := c.Delete(); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("Failed to sweep dedupe store", "err", err)
+		}
+	}
+}
+
+// Close implements Store.
+func (d *diskStore) Close() error {
+	close(d.done)
+	return d.db.Close()
+}
+
+func expiry(v []byte) time.Time {
+	if len(v) != 8 {
+		return time.Time{}
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(v)), 0)
+}
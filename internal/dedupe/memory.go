@@ -0,0 +1,38 @@
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+type memoryStore struct {
+	mu   sync.Mutex
+	seen *expirable.LRU[string, struct{}]
+}
+
+// NewMemory returns a Store that keeps up to size event IDs in memory. It is
+// forgotten on restart, so recent events may be notified again.
+func NewMemory(size int, ttl time.Duration) Store {
+	return &memoryStore{seen: expirable.NewLRU[string, struct{}](size, nil, ttl)}
+}
+
+// SeenOrMark implements Store.
+func (m *memoryStore) SeenOrMark(ctx context.Context, eventID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seen.Contains(eventID) {
+		return true, nil
+	}
+	m.seen.Add(eventID, struct{}{})
+	return false, nil
+}
+
+// Close implements Store.
+func (m *memoryStore) Close() error {
+	m.seen.Purge()
+	return nil
+}
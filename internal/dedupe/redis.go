@@ -0,0 +1,59 @@
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+const redisPrefix = "frigate:seen:"
+
+type redisStore struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func NewRedis(rdb *redis.Client, ttl time.Duration) Store {
+	return &redisStore{rdb: rdb, ttl: ttl}
+}
+
+// SeenOrMark implements Store using SETNX, so two pollers racing on the same
+// event can't both win.
+func (r *redisStore) SeenOrMark(ctx context.Context, eventID string) (bool, error) {
+	marked, err := r.rdb.SetNX(ctx, redisPrefix+eventID, time.Now().Unix(), r.ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark event %s: %w", eventID, err)
+	}
+	if !marked {
+		return true, nil
+	}
+	seen, err := r.seenByLegacy(ctx, eventID)
+	if err != nil {
+		// Unmark it, so that the next poll checks again instead of dropping it.
+		r.rdb.Del(context.WithoutCancel(ctx), redisPrefix+eventID)
+		return false, err
+	}
+	return seen, nil
+}
+
+// seenByLegacy reports whether an earlier version, which stored the event ID
+// under its own name for a day, already notified eventID. It keeps events in
+// flight during an upgrade from being notified twice.
+func (r *redisStore) seenByLegacy(ctx context.Context, eventID string) (bool, error) {
+	v, err := r.rdb.Get(ctx, eventID).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up legacy mark of event %s: %w", eventID, err)
+	}
+	return v == eventID, nil
+}
+
+// Close implements Store. The client is shared and closed by its owner.
+func (r *redisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package frigate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// FalsePositive reports the event as a false positive to Frigate+.
+func (f *frigate) FalsePositive(ctx context.Context, eventID string) error {
+	return f.send(ctx, http.MethodPost, f.apiUrl+"/"+eventID+"/false_positive", nil)
+}
+
+// SetSubLabel sets the sub label of the event, e.g. the name of a person.
+func (f *frigate) SetSubLabel(ctx context.Context, eventID, subLabel string) error {
+	return f.send(ctx, http.MethodPost, f.apiUrl+"/"+eventID+"/sub_label", map[string]string{"subLabel": subLabel})
+}
+
+// Retain keeps the event and its recordings indefinitely.
+func (f *frigate) Retain(ctx context.Context, eventID string) error {
+	return f.send(ctx, http.MethodPost, f.apiUrl+"/"+eventID+"/retain", nil)
+}
+
+// DeleteEvent deletes the event along with its snapshot and clip.
+func (f *frigate) DeleteEvent(ctx context.Context, eventID string) error {
+	return f.send(ctx, http.MethodDelete, f.apiUrl+"/"+eventID, nil)
+}
+
+// SubmitPlus submits the snapshot of the event to Frigate+.
+func (f *frigate) SubmitPlus(ctx context.Context, eventID string) error {
+	return f.send(ctx, http.MethodPost, f.apiUrl+"/"+eventID+"/plus", nil)
+}
+
+// send makes a request changing something in Frigate, with body encoded as
+// JSON when not nil. Unlike getJSON it is never retried.
+func (f *frigate) send(ctx context.Context, method, rawURL string, body any) error {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return unavailable(rawURL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{URL: rawURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package frigate
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+)
+
+// tokenCookie is the cookie holding the JWT issued by Frigate 0.14+.
+const tokenCookie = "frigate_token"
+
+// authTransport authenticates every request sent to Frigate.
+type authTransport struct {
+	base     http.RoundTripper
+	mode     string
+	username string
+	password string
+	token    string
+	headers  map[string]string
+	loginURL string
+
+	mu  sync.Mutex
+	jwt string
+}
+
+// newTransport returns the RoundTripper authenticating requests to inst,
+// failing those whose response headers take longer than headerTimeout.
+func newTransport(inst config.FrigateInstance, headerTimeout time.Duration) (http.RoundTripper, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.ResponseHeaderTimeout = headerTimeout
+	if inst.CAFile != "" || inst.InsecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: inst.InsecureSkipVerify}
+		if inst.CAFile != "" {
+			pem, err := os.ReadFile(inst.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read Frigate CA: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate found in %s", inst.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		base.TLSClientConfig = tlsConfig
+	}
+
+	mode := inst.Auth
+	if mode == "" {
+		switch {
+		case inst.Token != "":
+			mode = "bearer"
+		case inst.Username != "":
+			mode = "login"
+		default:
+			mode = "none"
+		}
+	}
+	switch mode {
+	case "none", "login", "basic", "bearer":
+	default:
+		return nil, fmt.Errorf("unknown Frigate auth %q", mode)
+	}
+
+	headers := make(map[string]string)
+	for _, h := range inst.Headers {
+		k, v, ok := strings.Cut(h, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid Frigate header %q, expected Name=value", h)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return &authTransport{
+		base:     base,
+		mode:     mode,
+		username: inst.Username,
+		password: inst.Password,
+		token:    inst.Token,
+		headers:  headers,
+		loginURL: inst.URL + "/api/login",
+	}, nil
+}
+
+// RoundTrip implements http.RoundTripper. In login mode a missing or
+// expired JWT triggers a login, and the refreshed token Frigate hands back in
+// responses replaces the current one.
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.mode == "login" && t.currentJWT() == "" {
+		if err := t.login(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.base.RoundTrip(t.authorize(req))
+	if err != nil {
+		return nil, err
+	}
+	if t.mode != "login" {
+		return resp, nil
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && (req.Body == nil || req.GetBody != nil) {
+		resp.Body.Close()
+		if err := t.login(req); err != nil {
+			return nil, err
+		}
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		if resp, err = t.base.RoundTrip(t.authorize(retry)); err != nil {
+			return nil, err
+		}
+	}
+	t.refresh(resp)
+	return resp, nil
+}
+
+func (t *authTransport) authorize(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	switch t.mode {
+	case "basic":
+		req.SetBasicAuth(t.username, t.password)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	case "login":
+		req.AddCookie(&http.Cookie{Name: tokenCookie, Value: t.currentJWT()})
+	}
+	return req
+}
+
+func (t *authTransport) login(orig *http.Request) error {
+	body, _ := json.Marshal(map[string]string{"user": t.username, "password": t.password})
+	req, err := http.NewRequestWithContext(orig.Context(), http.MethodPost, t.loginURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return unavailable(t.loginURL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{URL: t.loginURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if !t.refresh(resp) {
+		return fmt.Errorf("frigate: login response has no %s cookie", tokenCookie)
+	}
+	return nil
+}
+
+// refresh stores the JWT set by resp, if any.
+func (t *authTransport) refresh(resp *http.Response) bool {
+	for _, c := range resp.Cookies() {
+		if c.Name == tokenCookie && c.Value != "" {
+			t.mu.Lock()
+			t.jwt = c.Value
+			t.mu.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+func (t *authTransport) currentJWT() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.jwt
+}
@@ -1,27 +1,10 @@
 package frigate
 
-type EventStruct struct {
-	Box    interface{} `json:"box"`
-	Camera string      `json:"camera"`
-	Data   struct {
-		Attributes []interface{} `json:"attributes"`
-		Box        []float64     `json:"box"`
-		Region     []float64     `json:"region"`
-		Score      float64       `json:"score"`
-		TopScore   float64       `json:"top_score"`
-		Type       string        `json:"type"`
-	} `json:"data"`
-	EndTime            *float64    `json:"end_time"`
-	FalsePositive      interface{} `json:"false_positive"`
-	HasClip            bool        `json:"has_clip"`
-	HasSnapshot        bool        `json:"has_snapshot"`
-	ID                 string      `json:"id"`
-	Label              string      `json:"label"`
-	PlusID             interface{} `json:"plus_id"`
-	RetainIndefinitely bool        `json:"retain_indefinitely"`
-	StartTime          float64     `json:"start_time"`
-	SubLabel           []any       `json:"sub_label"`
-	Thumbnail          string      `json:"thumbnail"`
-	TopScore           interface{} `json:"top_score"`
-	Zones              []any       `json:"zones"`
-}
+import "github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate/model"
+
+type (
+	// EventStruct is the event payload of the Frigate API.
+	EventStruct = model.Event
+	// ReviewStruct is the review segment payload of the Frigate API.
+	ReviewStruct = model.Review
+)
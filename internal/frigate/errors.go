@@ -0,0 +1,55 @@
+package frigate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrNotFound is returned when Frigate doesn't know the requested
+	// resource, e.g. an event that was deleted.
+	ErrNotFound = errors.New("frigate: not found")
+	// ErrUnavailable is returned when Frigate can't be reached or answers
+	// with a server error. It is worth retrying later.
+	ErrUnavailable = errors.New("frigate: unavailable")
+)
+
+// StatusError is returned for unexpected HTTP responses. It matches
+// ErrNotFound for 404 and ErrUnavailable for 5xx.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("frigate: %s returned %s", e.URL, e.Status)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnavailable:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// DecodeError is returned when a response isn't the JSON we expect.
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("frigate: decode %s: %v", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// unavailable wraps a transport error so it matches ErrUnavailable.
+func unavailable(url string, err error) error {
+	return fmt.Errorf("%w: %s: %w", ErrUnavailable, url, err)
+}
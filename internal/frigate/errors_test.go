@@ -0,0 +1,138 @@
+package frigate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status      int
+		notFound    bool
+		unavailable bool
+	}{
+		{http.StatusNotFound, true, false},
+		{http.StatusInternalServerError, false, true},
+		{http.StatusBadGateway, false, true},
+		{http.StatusUnauthorized, false, false},
+		{http.StatusBadRequest, false, false},
+	}
+	for _, tt := range tests {
+		var err error = &StatusError{URL: "http://frigate/api/events/x", StatusCode: tt.status, Status: http.StatusText(tt.status)}
+		err = errors.Join(errors.New("get event x"), err)
+		if errors.Is(err, ErrNotFound) != tt.notFound || errors.Is(err, ErrUnavailable) != tt.unavailable {
+			t.Errorf("%d: not found %v, unavailable %v", tt.status, errors.Is(err, ErrNotFound), errors.Is(err, ErrUnavailable))
+		}
+	}
+
+	cause := errors.New("connection refused")
+	if err := unavailable("http://frigate", cause); !errors.Is(err, ErrUnavailable) || !errors.Is(err, cause) {
+		t.Errorf("transport error %v doesn't match", err)
+	}
+	var decodeErr *DecodeError
+	if err := error(&DecodeError{URL: "http://frigate", Err: cause}); !errors.As(err, &decodeErr) || !errors.Is(err, cause) || errors.Is(err, ErrUnavailable) {
+		t.Errorf("decode error %v doesn't match", err)
+	}
+}
+
+func TestGetJSONRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  func(call int32, w http.ResponseWriter, r *http.Request)
+		calls    int32
+		match    error
+		decoding bool
+	}{
+		{"ok", func(_ int32, w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"id":"x"}`)) }, 1, nil, false},
+		{"server error then ok", func(call int32, w http.ResponseWriter, r *http.Request) {
+			if call == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"id":"x"}`))
+		}, 2, nil, false},
+		{"server down", func(_ int32, w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, 3, ErrUnavailable, false},
+		{"timeout", func(_ int32, w http.ResponseWriter, r *http.Request) { <-r.Context().Done() }, 3, ErrUnavailable, false},
+		{"not found", func(_ int32, w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) }, 1, ErrNotFound, false},
+		{"bad JSON", func(_ int32, w http.ResponseWriter, r *http.Request) { w.Write([]byte(`<html>`)) }, 1, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FRIGATE_RETRIES", "2")
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(calls.Add(1), w, r)
+			}))
+			defer srv.Close()
+
+			f, err := NewFrigate(config.FrigateInstance{URL: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.(*frigate).timeout = 200 * time.Millisecond
+			_, _, err = f.GetEvent(context.Background(), "x")
+
+			var decodeErr *DecodeError
+			switch {
+			case tt.match != nil && !errors.Is(err, tt.match):
+				t.Errorf("got %v, want %v", err, tt.match)
+			case tt.decoding && !errors.As(err, &decodeErr):
+				t.Errorf("got %v, want a DecodeError", err)
+			case tt.match == nil && !tt.decoding && err != nil:
+				t.Errorf("got %v", err)
+			}
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("%d requests, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDownloadStalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"no response", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}},
+		{"body stops", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(make([]byte, 1024))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FRIGATE_DOWNLOAD_TIMEOUT", "1")
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			f, err := NewFrigate(config.FrigateInstance{URL: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() {
+				_, err := f.WriteClip(context.Background(), EventStruct{ID: "x"}, io.Discard)
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if !errors.Is(err, ErrUnavailable) {
+					t.Errorf("got %v, want ErrUnavailable", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("download still waiting for Frigate")
+			}
+		})
+	}
+}
@@ -1,175 +1,363 @@
 package frigate
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
-
-	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
 )
 
 type (
 	frigate struct {
-		cfg    *config.Config
-		apiUrl string
+		cfg     *config.Config
+		inst    config.FrigateInstance
+		apiUrl  string
+		client  *http.Client
+		timeout time.Duration
+		idle    time.Duration
 	}
 
 	Frigate interface {
-		Events() ([]EventStruct, error)
-		GetEvent(eventID string) (*EventStruct, bool, error)
-		SaveThumbnail(evt EventStruct) string
-		SaveClip(evt EventStruct) string
+		Events(ctx context.Context) ([]EventStruct, error)
+		GetEvent(ctx context.Context, eventID string) (*EventStruct, bool, error)
+		WriteThumbnail(evt EventStruct, w io.Writer) error
+		SaveThumbnail(evt EventStruct) (string, error)
+		WriteClip(ctx context.Context, evt EventStruct, w io.Writer) (int64, error)
+		SaveClip(ctx context.Context, evt EventStruct) (string, error)
+		WriteSnapshot(ctx context.Context, evt EventStruct, opts url.Values, w io.Writer) error
+		SaveSnapshot(ctx context.Context, evt EventStruct, opts url.Values) (string, error)
+		WritePreview(ctx context.Context, evt EventStruct, format string, w io.Writer) error
+		SavePreview(ctx context.Context, evt EventStruct, format string) (string, error)
+		Reviews(ctx context.Context, severities []string) ([]ReviewStruct, error)
+		GetReview(ctx context.Context, reviewID string) (*ReviewStruct, bool, error)
+		WriteRecording(ctx context.Context, camera string, start, end float64, w io.Writer) (int64, error)
+		SaveRecording(ctx context.Context, camera string, start, end float64) (string, error)
+		SubscribeReviews(ctx context.Context, handler func(ReviewStruct)) error
+		FalsePositive(ctx context.Context, eventID string) error
+		SetSubLabel(ctx context.Context, eventID, subLabel string) error
+		Retain(ctx context.Context, eventID string) error
+		DeleteEvent(ctx context.Context, eventID string) error
+		SubmitPlus(ctx context.Context, eventID string) error
+		Version(ctx context.Context) (string, error)
 	}
 )
 
-func NewFrigate() (Frigate, error) {
+// NewFrigate returns a client for the Frigate instance inst.
+func NewFrigate(inst config.FrigateInstance) (Frigate, error) {
 	cfg := config.New()
-	apiUrl := cfg.FrigateURL + "/api/events"
-	return &frigate{cfg: cfg, apiUrl: apiUrl}, nil
-}
+	apiUrl := inst.URL + "/api/events"
 
-func (f *frigate) Events() ([]EventStruct, error) {
-	FrigateURL := f.apiUrl + "?limit=" + strconv.Itoa(f.cfg.FrigateEventLimit)
-
-	FrigateURL += "&in_progress=1"
-
-	// Request to Frigate
-	resp, err := http.Get(FrigateURL)
+	idle := time.Duration(max(cfg.FrigateDownloadTimeout, 1)) * time.Second
+	transport, err := newTransport(inst, idle)
 	if err != nil {
 		return nil, err
 	}
-	if resp == nil || resp.Body == nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	// Check response status code
-	if resp.StatusCode != 200 {
-		return nil, err
-	}
 
-	// Read data from response
-	byteValue, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+	return &frigate{
+		cfg:    cfg,
+		inst:   inst,
+		apiUrl: apiUrl,
+		// No client wide timeout: clip downloads can take long. API calls
+		// get their own deadline in getJSON, downloads are abandoned once
+		// Frigate stops sending for idle.
+		client:  &http.Client{Transport: transport},
+		timeout: time.Duration(cfg.FrigateTimeout) * time.Second,
+		idle:    idle,
+	}, nil
+}
 
-	// Parse data from JSON to struct
+func (f *frigate) Events(ctx context.Context) ([]EventStruct, error) {
+	FrigateURL := f.apiUrl + "?limit=" + strconv.Itoa(f.inst.EventLimit)
+
+	FrigateURL += "&in_progress=1"
 
 	var events []EventStruct
-	err1 := json.Unmarshal(byteValue, &events)
-	if err1 != nil {
-		if e, ok := err.(*json.SyntaxError); ok {
-			log.Println("syntax error at byte offset " + strconv.Itoa(int(e.Offset)) + " URL: " + FrigateURL)
-		}
-		log.Println("Exit. URL: " + FrigateURL)
+	if err := f.getJSON(ctx, FrigateURL, &events); err != nil {
 		return nil, err
 	}
 
 	// Return Events
 	return events, nil
-
 }
 
-func (f *frigate) GetEvent(eventID string) (*EventStruct, bool, error) {
+func (f *frigate) GetEvent(ctx context.Context, eventID string) (*EventStruct, bool, error) {
 	FrigateURL := f.apiUrl + "/" + eventID
 
-	// Request to Frigate
-	resp, err := http.Get(FrigateURL)
-	if err != nil {
+	var event EventStruct
+	if err := f.getJSON(ctx, FrigateURL, &event); err != nil {
 		return nil, true, err
 	}
-	if resp == nil || resp.Body == nil {
-		return nil, true, err
+
+	return &event, event.InProgress(), nil
+}
+
+// Version returns the version of Frigate, which also tells it is reachable
+// and accepts our credentials.
+func (f *frigate) Version(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	var version strings.Builder
+	if _, err := f.download(ctx, f.inst.URL+"/api/version", &version); err != nil {
+		return "", err
+	}
+	return version.String(), nil
+}
+
+// getJSON decodes the response of rawURL into v. Network errors and 5xx
+// responses are retried cfg.FrigateRetries times with exponential backoff.
+func (f *frigate) getJSON(ctx context.Context, rawURL string, v any) error {
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := f.getJSONOnce(ctx, rawURL, v)
+		if err == nil || !errors.Is(err, ErrUnavailable) || attempt >= f.cfg.FrigateRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (f *frigate) getJSONOnce(ctx context.Context, rawURL string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+
+	// Request to Frigate
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return unavailable(rawURL, err)
 	}
 	defer resp.Body.Close()
+
 	// Check response status code
-	if resp.StatusCode != 200 {
-		return nil, true, err
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{URL: rawURL, StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	// Read data from response
 	byteValue, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, true, err
+		return unavailable(rawURL, err)
 	}
 
 	// Parse data from JSON to struct
-	var event EventStruct
-	err1 := json.Unmarshal(byteValue, &event)
-	if err1 != nil {
-		if e, ok := err.(*json.SyntaxError); ok {
-			log.Println("syntax error at byte offset " + strconv.Itoa(int(e.Offset)) + " URL: " + FrigateURL)
-		}
-		log.Println("Exit. URL: " + FrigateURL)
-		return nil, true, err
+	if err := json.Unmarshal(byteValue, v); err != nil {
+		return &DecodeError{URL: rawURL, Err: err}
 	}
-
-	// Return Events
-	inProgress := event.EndTime == nil
-	return &event, inProgress, nil
+	return nil
 }
 
-func (f *frigate) SaveThumbnail(evt EventStruct) string {
+// WriteThumbnail writes the JPEG thumbnail embedded in evt to w.
+func (f *frigate) WriteThumbnail(evt EventStruct, w io.Writer) error {
 	// Decode string Thumbnail base64
 	dec, err := base64.StdEncoding.DecodeString(evt.Thumbnail)
 	if err != nil {
-		log.Fatal("Error when decode base64: " + err.Error())
+		return fmt.Errorf("decode thumbnail of event %s: %w", evt.ID, err)
 	}
-
-	// Generate uniq filename
-	filename := "/tmp/" + evt.ID + ".jpg"
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Fatal("Error when create file: " + err.Error())
+	if _, err := w.Write(dec); err != nil {
+		return fmt.Errorf("write thumbnail of event %s: %w", evt.ID, err)
 	}
-	defer file.Close()
-	if _, err := file.Write(dec); err != nil {
-		log.Fatal("Error when write file: " + err.Error())
-	}
-	if err := file.Sync(); err != nil {
-		log.Fatal("Error when sync file: " + err.Error())
+	return nil
+}
+
+// SaveThumbnail writes the thumbnail of evt to a temporary file and returns
+// its path. The caller removes it.
+func (f *frigate) SaveThumbnail(evt EventStruct) (string, error) {
+	return saveTemp(evt.ID+"-*.jpg", func(w io.Writer) error {
+		return f.WriteThumbnail(evt, w)
+	})
+}
+
+// WriteClip streams the clip of evt to w and returns the number of bytes
+// written. A clip Frigate doesn't have matches ErrNotFound.
+func (f *frigate) WriteClip(ctx context.Context, evt EventStruct, w io.Writer) (int64, error) {
+	return f.download(ctx, f.apiUrl+"/"+evt.ID+"/clip.mp4", w)
+}
+
+// SaveClip downloads the clip of evt to a temporary file and returns its
+// path. The caller removes it.
+func (f *frigate) SaveClip(ctx context.Context, evt EventStruct) (string, error) {
+	return saveTemp(evt.ID+"-*.mp4", func(w io.Writer) error {
+		_, err := f.WriteClip(ctx, evt, w)
+		return err
+	})
+}
+
+// WriteSnapshot streams the full resolution snapshot of evt to w. opts are
+// passed as query to Frigate (bbox, crop, timestamp, h, quality).
+func (f *frigate) WriteSnapshot(ctx context.Context, evt EventStruct, opts url.Values, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	SnapshotURL := f.apiUrl + "/" + evt.ID + "/snapshot.jpg"
+	if len(opts) > 0 {
+		SnapshotURL += "?" + opts.Encode()
 	}
-	return filename
+	_, err := f.download(ctx, SnapshotURL, w)
+	return err
+}
+
+// SaveSnapshot writes the snapshot of evt to a temporary file and returns its
+// path. The caller removes it.
+func (f *frigate) SaveSnapshot(ctx context.Context, evt EventStruct, opts url.Values) (string, error) {
+	return saveTemp(evt.ID+"-*.jpg", func(w io.Writer) error {
+		return f.WriteSnapshot(ctx, evt, opts, w)
+	})
 }
 
-func (f *frigate) SaveClip(evt EventStruct) string {
-	// Get config
-	conf := config.New()
+// WritePreview streams a short animation of evt to w. format "gif" uses the
+// event preview, "mp4" the preview of the review segment holding the event
+// (Frigate 0.14+).
+func (f *frigate) WritePreview(ctx context.Context, evt EventStruct, format string, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
 
-	// Generate clip URL
-	ClipURL := conf.FrigateURL + "/api/events/" + evt.ID + "/clip.mp4"
+	PreviewURL := f.apiUrl + "/" + evt.ID + "/preview.gif"
+	if format == "mp4" {
+		var review struct {
+			ID string `json:"id"`
+		}
+		if err := f.getJSON(ctx, f.inst.URL+"/api/review/event/"+evt.ID, &review); err != nil {
+			return err
+		}
+		PreviewURL = f.inst.URL + "/api/review/" + review.ID + "/preview?format=mp4"
+	}
 
-	// Generate uniq filename
-	filename := "/tmp/" + evt.ID + ".mp4"
+	_, err := f.download(ctx, PreviewURL, w)
+	return err
+}
+
+// SavePreview writes the preview of evt to a temporary file and returns its
+// path. The caller removes it.
+func (f *frigate) SavePreview(ctx context.Context, evt EventStruct, format string) (string, error) {
+	return saveTemp(evt.ID+"-*."+format, func(w io.Writer) error {
+		return f.WritePreview(ctx, evt, format, w)
+	})
+}
 
-	// Create clip file
-	file, err := os.Create(filename)
+// download copies the body of rawURL to w.
+func (f *frigate) download(ctx context.Context, rawURL string, w io.Writer) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
-		log.Fatal("Error when create file: " + err.Error())
+		return 0, err
 	}
-	defer file.Close()
 
-	// Download clip file
-	resp, err := http.Get(ClipURL)
+	resp, err := f.client.Do(req)
 	if err != nil {
-		log.Fatal("Error when download clip: " + err.Error())
+		return 0, unavailable(rawURL, err)
 	}
 	defer resp.Body.Close()
 
 	// Check server response
 	if resp.StatusCode != http.StatusOK {
-		log.Fatal("Error when download clip: " + resp.Status)
+		return 0, &StatusError{URL: rawURL, StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
-	// Writer the body to file
-	_, err = io.Copy(file, resp.Body)
+	// Writer the body to w
+	body := newIdleReader(resp.Body, f.idle, cancel)
+	n, err := io.Copy(w, body)
+	if body.stop() {
+		return n, unavailable(rawURL, fmt.Errorf("no data for %s", f.idle))
+	}
+	if err != nil {
+		return n, unavailable(rawURL, err)
+	}
+	return n, nil
+}
+
+// idleReader calls cancel when reading r makes no progress for timeout.
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newIdleReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleReader {
+	ir := &idleReader{r: r, timeout: timeout}
+	ir.timer = time.AfterFunc(timeout, func() {
+		ir.expired.Store(true)
+		cancel()
+	})
+	return ir
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// stop stops the timer and reports whether it expired.
+func (r *idleReader) stop() bool {
+	r.timer.Stop()
+	return r.expired.Load()
+}
+
+var (
+	tempOnce sync.Once
+	tempDir  string
+)
+
+// tempPath returns the directory holding the downloads of this process, or
+// "" for the default temporary directory if it can't be created.
+func tempPath() string {
+	tempOnce.Do(func() {
+		tempDir, _ = os.MkdirTemp("", "frigate-s3-telegram-")
+	})
+	return tempDir
+}
+
+// RemoveTemp deletes the downloads left behind by work cut short, e.g. by a
+// shutdown. Nothing may be downloading anymore.
+func RemoveTemp() error {
+	if dir := tempPath(); dir != "" {
+		return os.RemoveAll(dir)
+	}
+	return nil
+}
+
+// saveTemp creates a temporary file named after pattern, fills it with write
+// and returns its path. Nothing is left behind on error.
+func saveTemp(pattern string, write func(w io.Writer) error) (string, error) {
+	file, err := os.CreateTemp(tempPath(), pattern)
+	if err != nil {
+		return "", fmt.Errorf("create file: %w", err)
+	}
+
+	err = write(file)
+	if cerr := file.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("close file: %w", cerr)
+	}
 	if err != nil {
-		log.Fatal("Error when write file: " + err.Error())
+		os.Remove(file.Name())
+		return "", err
 	}
-	return filename
+	return file.Name(), nil
 }
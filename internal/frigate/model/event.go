@@ -0,0 +1,125 @@
+// Package model holds the payloads of the Frigate API, decoded the same way
+// from Frigate 0.12 to 0.14.
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Event is a tracked object, as returned by /api/events.
+type Event struct {
+	ID                 string    `json:"id"`
+	Camera             string    `json:"camera"`
+	Label              string    `json:"label"`
+	SubLabel           SubLabel  `json:"sub_label"`
+	StartTime          float64   `json:"start_time"`
+	EndTime            *float64  `json:"end_time"`
+	FalsePositive      *bool     `json:"false_positive"`
+	HasClip            bool      `json:"has_clip"`
+	HasSnapshot        bool      `json:"has_snapshot"`
+	RetainIndefinitely bool      `json:"retain_indefinitely"`
+	PlusID             string    `json:"plus_id"`
+	Thumbnail          string    `json:"thumbnail"`
+	Zones              []string  `json:"zones"`
+	Data               EventData `json:"data"`
+
+	// Until Frigate 0.13 the box and score were top level, they moved to
+	// Data in 0.14. Use the Event methods to read them.
+	Box      []float64 `json:"box"`
+	TopScore *float64  `json:"top_score"`
+}
+
+// EventData is the "data" object of an event, filled since Frigate 0.14.
+type EventData struct {
+	Type       string    `json:"type"` // object or audio
+	Box        []float64 `json:"box"`
+	Region     []float64 `json:"region"`
+	Score      float64   `json:"score"`
+	TopScore   float64   `json:"top_score"`
+	Attributes []struct {
+		Label string    `json:"label"`
+		Box   []float64 `json:"box"`
+		Score float64   `json:"score"`
+	} `json:"attributes"`
+	SubLabel                    SubLabel `json:"sub_label"`
+	RecognizedLicensePlate      string   `json:"recognized_license_plate"`
+	RecognizedLicensePlateScore float64  `json:"recognized_license_plate_score"`
+	AverageEstimatedSpeed       float64  `json:"average_estimated_speed"`
+	VelocityAngle               float64  `json:"velocity_angle"`
+}
+
+// InProgress reports whether the object is still tracked.
+func (e Event) InProgress() bool {
+	return e.EndTime == nil
+}
+
+// Score returns the best score of the object.
+func (e Event) Score() float64 {
+	if e.TopScore != nil {
+		return *e.TopScore
+	}
+	return e.Data.TopScore
+}
+
+// BoundingBox returns the box of the object: pixels until Frigate 0.13,
+// fractions of the frame since 0.14.
+func (e Event) BoundingBox() []float64 {
+	if len(e.Data.Box) > 0 {
+		return e.Data.Box
+	}
+	return e.Box
+}
+
+// SubLabelName returns the sub label of the object, e.g. a recognized face,
+// or "" when there is none.
+func (e Event) SubLabelName() string {
+	if e.SubLabel.Label != "" {
+		return e.SubLabel.Label
+	}
+	return e.Data.SubLabel.Label
+}
+
+// SubLabel is a sub label and its score. Frigate 0.12 sends it as a plain
+// string, later versions as [label, score]; both decode here.
+type SubLabel struct {
+	Label string
+	Score float64
+}
+
+func (s *SubLabel) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		*s = SubLabel{}
+		return nil
+	case len(b) > 0 && b[0] == '"':
+		*s = SubLabel{}
+		return json.Unmarshal(b, &s.Label)
+	}
+
+	var pair []json.RawMessage
+	if err := json.Unmarshal(b, &pair); err != nil {
+		return fmt.Errorf("sub_label: %w", err)
+	}
+	*s = SubLabel{}
+	if len(pair) > 0 {
+		if err := json.Unmarshal(pair[0], &s.Label); err != nil {
+			return fmt.Errorf("sub_label: %w", err)
+		}
+	}
+	if len(pair) > 1 && !bytes.Equal(pair[1], []byte("null")) {
+		if err := json.Unmarshal(pair[1], &s.Score); err != nil {
+			return fmt.Errorf("sub_label: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s SubLabel) MarshalJSON() ([]byte, error) {
+	if s.Label == "" {
+		return []byte("null"), nil
+	}
+	return json.Marshal([]any{s.Label, s.Score})
+}
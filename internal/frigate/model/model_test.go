@@ -0,0 +1,175 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func decodeFixture(t *testing.T, name string, v any) {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatalf("decode %s: %v", name, err)
+	}
+}
+
+func TestEventFixtures(t *testing.T) {
+	type want struct {
+		id         string
+		label      string
+		inProgress bool
+		score      float64
+		box        []float64
+		subLabel   string
+		zones      []string
+		attributes []string
+		dataType   string
+	}
+	tests := []struct {
+		file   string
+		events []want
+	}{
+		{"events-0.12.json", []want{{
+			id:       "1686402031.4382-r8kd2q",
+			label:    "person",
+			score:    0.84765625,
+			box:      []float64{231, 102, 410, 393},
+			subLabel: "Alice",
+			zones:    []string{"porch"},
+		}}},
+		{"events-0.13.json", []want{{
+			id:       "1702550400.123456-abc123",
+			label:    "person",
+			score:    0.82421875,
+			box:      []float64{120, 80, 340, 460},
+			subLabel: "Alice",
+			zones:    []string{"porch", "walkway"},
+		}, {
+			id:         "1702550433.987654-xyz789",
+			label:      "car",
+			inProgress: true,
+			zones:      []string{},
+		}}},
+		{"events-0.14.json", []want{{
+			id:         "1725000000.654321-def456",
+			label:      "car",
+			score:      0.79,
+			box:        []float64{0.3125, 0.4167, 0.2813, 0.25},
+			zones:      []string{"driveway"},
+			attributes: []string{"license_plate"},
+			dataType:   "object",
+		}, {
+			id:         "1725000010.000001-ghi789",
+			label:      "person",
+			inProgress: true,
+			score:      0.91,
+			box:        []float64{0.45, 0.1, 0.2, 0.55},
+			subLabel:   "Bob",
+			zones:      []string{},
+			attributes: []string{"face"},
+			dataType:   "object",
+		}, {
+			id:       "1725000050.25-aud001",
+			label:    "speech",
+			score:    0.77,
+			zones:    []string{},
+			dataType: "audio",
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			var events []Event
+			decodeFixture(t, tt.file, &events)
+			if len(events) != len(tt.events) {
+				t.Fatalf("got %d events, want %d", len(events), len(tt.events))
+			}
+			for i, w := range tt.events {
+				e := events[i]
+				var attributes []string
+				for _, a := range e.Data.Attributes {
+					attributes = append(attributes, a.Label)
+				}
+				got := want{
+					id:         e.ID,
+					label:      e.Label,
+					inProgress: e.InProgress(),
+					score:      e.Score(),
+					box:        e.BoundingBox(),
+					subLabel:   e.SubLabelName(),
+					zones:      e.Zones,
+					attributes: attributes,
+					dataType:   e.Data.Type,
+				}
+				if !reflect.DeepEqual(got, w) {
+					t.Errorf("event %d:\n got %+v\nwant %+v", i, got, w)
+				}
+			}
+		})
+	}
+}
+
+func TestReviewFixtures(t *testing.T) {
+	var reviews []Review
+	decodeFixture(t, "reviews-0.14.json", &reviews)
+
+	tests := []struct {
+		id         string
+		severity   string
+		inProgress bool
+		labels     []string
+		detections []string
+	}{
+		{"1725000000.6-r4nd0m", "alert", false, []string{"car", "person"}, []string{"1725000000.654321-def456", "1725000012.2-jkl012"}},
+		{"1725000050.3-s0und1", "detection", true, []string{"speech"}, []string{"1725000050.25-aud001"}},
+	}
+	if len(reviews) != len(tests) {
+		t.Fatalf("got %d reviews, want %d", len(reviews), len(tests))
+	}
+	for i, tt := range tests {
+		r := reviews[i]
+		if r.ID != tt.id || r.Severity != tt.severity || (r.EndTime == nil) != tt.inProgress {
+			t.Errorf("review %d: got %s %s in progress %v, want %s %s %v", i, r.ID, r.Severity, r.EndTime == nil, tt.id, tt.severity, tt.inProgress)
+		}
+		if got := r.Labels(); !reflect.DeepEqual(got, tt.labels) {
+			t.Errorf("review %d: labels %v, want %v", i, got, tt.labels)
+		}
+		if !reflect.DeepEqual(r.Data.Detections, tt.detections) {
+			t.Errorf("review %d: detections %v, want %v", i, r.Data.Detections, tt.detections)
+		}
+	}
+}
+
+func TestSubLabel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SubLabel
+	}{
+		{`null`, SubLabel{}},
+		{`"Alice"`, SubLabel{Label: "Alice"}},
+		{`["Bob", 0.91]`, SubLabel{Label: "Bob", Score: 0.91}},
+		{`["Bob", null]`, SubLabel{Label: "Bob"}},
+		{`["Bob"]`, SubLabel{Label: "Bob"}},
+		{`[]`, SubLabel{}},
+	}
+	for _, tt := range tests {
+		var got SubLabel
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	var bad SubLabel
+	if err := json.Unmarshal([]byte(`{"label": "Bob"}`), &bad); err == nil {
+		t.Error("an object decoded as a sub label")
+	}
+}
@@ -0,0 +1,37 @@
+package model
+
+import "strings"
+
+// Review is a review segment of Frigate 0.14+: the events of a camera
+// grouped over a period of activity, rated as an alert or a detection.
+type Review struct {
+	ID              string   `json:"id"`
+	Camera          string   `json:"camera"`
+	StartTime       float64  `json:"start_time"`
+	EndTime         *float64 `json:"end_time"`
+	Severity        string   `json:"severity"`
+	ThumbPath       string   `json:"thumb_path"`
+	HasBeenReviewed bool     `json:"has_been_reviewed"`
+	Data            struct {
+		Detections []string `json:"detections"`
+		Objects    []string `json:"objects"`
+		SubLabels  []string `json:"sub_labels"`
+		Zones      []string `json:"zones"`
+		Audio      []string `json:"audio"`
+	} `json:"data"`
+}
+
+// Labels returns the distinct objects and sounds detected in the segment.
+func (r Review) Labels() []string {
+	var labels []string
+	seen := make(map[string]bool)
+	for _, l := range append(append([]string{}, r.Data.Objects...), r.Data.Audio...) {
+		// Objects in a zone are reported as "person-verified" and alike.
+		l, _, _ = strings.Cut(l, "-verified")
+		if !seen[l] {
+			seen[l] = true
+			labels = append(labels, l)
+		}
+	}
+	return labels
+}
@@ -0,0 +1,86 @@
+package frigate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// reviewMessage is what Frigate publishes on <prefix>/reviews whenever a
+// review segment starts, changes or ends.
+type reviewMessage struct {
+	Type   string       `json:"type"` // new, update or end
+	Before ReviewStruct `json:"before"`
+	After  ReviewStruct `json:"after"`
+}
+
+// SubscribeReviews calls handler with every review segment Frigate publishes
+// over MQTT until ctx is done. The broker connection is retried in the
+// background, so it only fails on an unusable configuration.
+func (f *frigate) SubscribeReviews(ctx context.Context, handler func(ReviewStruct)) error {
+	if f.inst.MQTTURL == "" {
+		return fmt.Errorf("no MQTT broker configured for Frigate %s", f.inst.URL)
+	}
+	topic := f.inst.MQTTTopicPrefix + "/reviews"
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(f.inst.MQTTURL).
+		SetClientID(clientID()).
+		SetUsername(f.inst.MQTTUsername).
+		SetPassword(f.inst.MQTTPassword).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(30 * time.Second)
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		// Subscriptions don't survive a reconnection with a clean session.
+		token := c.Subscribe(topic, 1, func(_ mqtt.Client, m mqtt.Message) {
+			var msg reviewMessage
+			if err := json.Unmarshal(m.Payload(), &msg); err != nil {
+				slog.Warn("Ignoring malformed MQTT message", "topic", topic, "err", err)
+				return
+			}
+			handler(msg.After)
+		})
+		if token.Wait() && token.Error() != nil {
+			slog.Error("Failed to subscribe to MQTT topic", "topic", topic, "err", token.Error())
+		}
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		slog.Warn("Lost connection to MQTT broker", "broker", f.inst.MQTTURL, "err", err)
+	})
+
+	client := mqtt.NewClient(opts)
+	// With connect retry the token only completes once the broker answers,
+	// so wait for it along with ctx.
+	token := client.Connect()
+	defer client.Disconnect(250)
+	select {
+	case <-token.Done():
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("failed to connect to MQTT broker %s: %w", f.inst.MQTTURL, err)
+		}
+	case <-ctx.Done():
+		return nil
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// clientID names the MQTT connection of this process. Containers share the
+// hostname pattern and PID 1, and a broker drops a client when another one
+// connects with its ID, so the ID ends with random bytes.
+func clientID() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("frigate-s3-telegram-%s-%d", hostname, os.Getpid())
+	}
+	return fmt.Sprintf("frigate-s3-telegram-%s-%x", hostname, suffix)
+}
@@ -0,0 +1,39 @@
+package frigate
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+)
+
+func TestSubscribeReviewsStopsWithoutBroker(t *testing.T) {
+	// A port nothing listens on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	f, err := NewFrigate(config.FrigateInstance{URL: "http://frigate", MQTTURL: "tcp://" + addr, MQTTTopicPrefix: "frigate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- f.SubscribeReviews(ctx, func(ReviewStruct) {}) }()
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SubscribeReviews kept waiting for the broker after ctx was done")
+	}
+}
@@ -0,0 +1,62 @@
+package frigate
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// Reviews returns the review segments in progress with one of severities.
+// Like Events, finished segments are left out: they were notified while in
+// progress, and listing them would notify them again whenever the dedupe
+// store forgot them, e.g. on a fresh start.
+func (f *frigate) Reviews(ctx context.Context, severities []string) ([]ReviewStruct, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(f.inst.EventLimit))
+	if len(severities) == 1 {
+		query.Set("severity", severities[0])
+	}
+
+	var reviews []ReviewStruct
+	if err := f.getJSON(ctx, f.inst.URL+"/api/review?"+query.Encode(), &reviews); err != nil {
+		return nil, err
+	}
+
+	filtered := reviews[:0]
+	for _, r := range reviews {
+		if r.EndTime == nil && slices.Contains(severities, r.Severity) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
+
+func (f *frigate) GetReview(ctx context.Context, reviewID string) (*ReviewStruct, bool, error) {
+	var review ReviewStruct
+	if err := f.getJSON(ctx, f.inst.URL+"/api/review/"+reviewID, &review); err != nil {
+		return nil, true, err
+	}
+
+	inProgress := review.EndTime == nil
+	return &review, inProgress, nil
+}
+
+// WriteRecording streams the recordings of camera between start and end
+// (unix timestamps) to w as a single MP4.
+func (f *frigate) WriteRecording(ctx context.Context, camera string, start, end float64, w io.Writer) (int64, error) {
+	RecordingURL := f.inst.URL + "/api/" + url.PathEscape(camera) +
+		"/start/" + strconv.FormatFloat(start, 'f', -1, 64) +
+		"/end/" + strconv.FormatFloat(end, 'f', -1, 64) + "/clip.mp4"
+	return f.download(ctx, RecordingURL, w)
+}
+
+// SaveRecording writes the recordings of camera between start and end to a
+// temporary file and returns its path. The caller removes it.
+func (f *frigate) SaveRecording(ctx context.Context, camera string, start, end float64) (string, error) {
+	return saveTemp(camera+"-*.mp4", func(w io.Writer) error {
+		_, err := f.WriteRecording(ctx, camera, start, end, w)
+		return err
+	})
+}
@@ -0,0 +1,175 @@
+// Package health serves /healthz, telling whether the process is alive and
+// its loops are ticking, and /readyz, telling whether its dependencies
+// answer.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+)
+
+type (
+	// Check returns nil when the dependency or component is usable.
+	Check func(ctx context.Context) error
+
+	// Status is the state of one check, as served in JSON.
+	Status struct {
+		OK          bool       `json:"ok"`
+		Error       string     `json:"error,omitempty"`
+		LastSuccess *time.Time `json:"last_success,omitempty"`
+	}
+
+	// Report is the body of /healthz and /readyz.
+	Report struct {
+		OK     bool              `json:"ok"`
+		Checks map[string]Status `json:"checks"`
+	}
+
+	health struct {
+		staleAfter time.Duration
+		timeout    time.Duration
+
+		mu       sync.Mutex
+		loops    map[string]time.Time
+		liveness map[string]Check
+		ready    map[string]Check
+		lastOK   map[string]time.Time
+	}
+
+	Health interface {
+		// Tick records that the loop name is still running. A loop that
+		// doesn't tick for HEALTH_STALE_AFTER fails /healthz.
+		Tick(name string)
+		// Stop forgets the loop name, e.g. when a follower stops polling.
+		Stop(name string)
+		// AddLiveness adds a check to /healthz, for components whose death
+		// needs a restart.
+		AddLiveness(name string, check Check)
+		// AddReadiness adds a dependency check to /readyz.
+		AddReadiness(name string, check Check)
+		LiveHandler() http.Handler
+		ReadyHandler() http.Handler
+	}
+)
+
+func New() Health {
+	cfg := config.New()
+	return &health{
+		staleAfter: time.Duration(cfg.HealthStaleAfter) * time.Second,
+		timeout:    time.Duration(cfg.HealthTimeout) * time.Second,
+		loops:      make(map[string]time.Time),
+		liveness:   make(map[string]Check),
+		ready:      make(map[string]Check),
+		lastOK:     make(map[string]time.Time),
+	}
+}
+
+func (h *health) Tick(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.loops[name] = time.Now()
+}
+
+func (h *health) Stop(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.loops, name)
+}
+
+func (h *health) AddLiveness(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness[name] = check
+}
+
+func (h *health) AddReadiness(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready[name] = check
+}
+
+func (h *health) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.run(r.Context(), h.liveness)
+
+		h.mu.Lock()
+		for name, last := range h.loops {
+			last := last
+			st := Status{OK: time.Since(last) < h.staleAfter, LastSuccess: &last}
+			if !st.OK {
+				st.Error = "loop stopped ticking"
+				report.OK = false
+			}
+			report.Checks[name] = st
+		}
+		h.mu.Unlock()
+
+		serve(w, report)
+	})
+}
+
+func (h *health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve(w, h.run(r.Context(), h.ready))
+	})
+}
+
+// run runs checks concurrently, each within h.timeout.
+func (h *health) run(ctx context.Context, checks map[string]Check) Report {
+	h.mu.Lock()
+	pending := make(map[string]Check, len(checks))
+	for name, check := range checks {
+		pending[name] = check
+	}
+	h.mu.Unlock()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		report = Report{OK: true, Checks: make(map[string]Status, len(pending))}
+	)
+	for name, check := range pending {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+			err := check(ctx)
+
+			h.mu.Lock()
+			if err == nil {
+				h.lastOK[name] = time.Now()
+			}
+			last, ok := h.lastOK[name]
+			h.mu.Unlock()
+
+			st := Status{OK: err == nil}
+			if err != nil {
+				st.Error = err.Error()
+			}
+			if ok {
+				st.LastSuccess = &last
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = st
+			report.OK = report.OK && st.OK
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func serve(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if !report.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
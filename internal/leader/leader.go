@@ -0,0 +1,181 @@
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	redis "github.com/redis/go-redis/v9"
+)
+
+const leaseKey = "frigate:leader"
+
+var (
+	renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+type (
+	// Elector decides which replica runs the work that must not be
+	// duplicated, like polling Frigate.
+	Elector interface {
+		// Run campaigns until ctx is done. Every time this replica becomes
+		// leader, lead is called with a context that is cancelled when the
+		// leadership is lost. Run waits for lead to return before campaigning
+		// again.
+		Run(ctx context.Context, lead func(ctx context.Context))
+		IsLeader() bool
+	}
+
+	redisElector struct {
+		rdb    *redis.Client
+		id     string
+		lease  time.Duration
+		leader atomic.Bool
+	}
+
+	// single is used when leader election is disabled: the only replica is
+	// always the leader.
+	single struct{}
+)
+
+// New returns a Redis lease based Elector, or one that always leads when
+// cfg.LeaderElection is false.
+func New(rdb *redis.Client) Elector {
+	cfg := config.New()
+	if !cfg.LeaderElection {
+		return single{}
+	}
+	return NewRedis(rdb, time.Duration(cfg.LeaderLease)*time.Second)
+}
+
+// NewRedis returns an Elector holding the lease frigate:leader while leading.
+// The lease is renewed every third of its duration.
+func NewRedis(rdb *redis.Client, lease time.Duration) Elector {
+	return &redisElector{rdb: rdb, id: instanceID(), lease: lease}
+}
+
+// Run implements Elector.
+func (e *redisElector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	ticker := time.NewTicker(e.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := e.rdb.SetNX(ctx, leaseKey, e.id, e.lease).Result()
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Leader election failed", "err", err)
+		}
+		if acquired {
+			e.hold(ctx, ticker, lead)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// hold runs lead while renewing the lease, and returns once either is over.
+func (e *redisElector) hold(ctx context.Context, ticker *time.Ticker, lead func(ctx context.Context)) {
+	e.setLeader(true)
+	defer e.setLeader(false)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		e.release()
+	}()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := renewScript.Run(ctx, e.rdb, []string{leaseKey}, e.id, e.lease.Milliseconds()).Int()
+		switch {
+		case err == nil && ok == 1:
+			renewed = time.Now()
+		case err == nil:
+			slog.Warn("Leader lease was taken over by another replica", "replica", e.id)
+			return
+		case time.Since(renewed) > e.lease-e.lease/3:
+			// Step down before the lease expires under us.
+			slog.Error("Could not renew leader lease", "replica", e.id, "err", err)
+			return
+		}
+	}
+}
+
+func (e *redisElector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := releaseScript.Run(ctx, e.rdb, []string{leaseKey}, e.id).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		slog.Error("Could not release leader lease", "replica", e.id, "err", err)
+	}
+}
+
+func (e *redisElector) setLeader(leader bool) {
+	e.leader.Store(leader)
+	metrics.LeaderChanges.Inc()
+	if leader {
+		metrics.LeaderIsLeader.Set(1)
+		slog.Info("Replica became leader", "replica", e.id)
+	} else {
+		metrics.LeaderIsLeader.Set(0)
+		slog.Info("Replica is no longer leader", "replica", e.id)
+	}
+}
+
+// IsLeader implements Elector.
+func (e *redisElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run implements Elector.
+func (single) Run(ctx context.Context, lead func(ctx context.Context)) {
+	metrics.LeaderIsLeader.Set(1)
+	lead(ctx)
+	<-ctx.Done()
+}
+
+// IsLeader implements Elector.
+func (single) IsLeader() bool {
+	return true
+}
+
+func instanceID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
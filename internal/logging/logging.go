@@ -0,0 +1,91 @@
+// Package logging configures log/slog and carries a logger with the
+// attributes of the event being processed through contexts.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+)
+
+type (
+	loggerKey      struct{}
+	correlationKey struct{}
+)
+
+// Setup makes the logger selected by cfg.LogFormat and cfg.LogLevel the
+// default, also for the standard log package.
+func Setup() {
+	cfg := config.New()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.LogFormat) {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// From returns the logger stored in ctx, or the default one.
+func From(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// With returns a context whose logger adds args to every record.
+func With(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey{}, From(ctx).With(args...))
+}
+
+// WithEvent returns a context logging the event ID, camera and label.
+// Empty values are left out.
+func WithEvent(ctx context.Context, eventID, camera, label string) context.Context {
+	var args []any
+	for _, a := range []slog.Attr{
+		slog.String("event_id", eventID),
+		slog.String("camera", camera),
+		slog.String("label", label),
+	} {
+		if a.Value.String() != "" {
+			args = append(args, a)
+		}
+	}
+	return With(ctx, args...)
+}
+
+// WithCorrelationID returns a context carrying id, which is logged with
+// every record and travels with queue messages. An empty id gets a new one.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		id = NewCorrelationID()
+	}
+	ctx = context.WithValue(ctx, correlationKey{}, id)
+	return With(ctx, slog.String("correlation_id", id))
+}
+
+// CorrelationID returns the correlation ID of ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,235 @@
+// Package media runs ffmpeg over clips before they are sent to Telegram:
+// reading their dimensions, moving their index to the front for streaming,
+// and re-encoding or cutting the ones that are too big.
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+)
+
+// MaxParts is the most videos Telegram accepts in one media group.
+const MaxParts = 10
+
+const (
+	audioBitrate = 64_000 // bits per second
+	// minVideoBitrate is the least a re-encoded clip is worth watching at.
+	minVideoBitrate = 150_000
+)
+
+// ErrTooLong is returned when a clip can't be made to fit.
+var ErrTooLong = errors.New("clip is too long to fit")
+
+type (
+	// Info describes a video as Telegram wants to know it.
+	Info struct {
+		Width    int
+		Height   int
+		Duration time.Duration
+	}
+
+	media struct {
+		ffmpeg  string
+		ffprobe string
+	}
+
+	Media interface {
+		// Duration returns the length of the video at path.
+		Duration(ctx context.Context, path string) (time.Duration, error)
+		// Probe returns the dimensions and duration of the video at path.
+		Probe(ctx context.Context, path string) (Info, error)
+		// Faststart moves the index of the MP4 at path in front of its
+		// data, without re-encoding. It returns the path of the remuxed
+		// file next to the original, or path itself when it needs no change.
+		Faststart(ctx context.Context, path string) (string, error)
+		// Shrink re-encodes the video at path to less than maxSize bytes,
+		// with a bitrate computed from its duration. It returns the path of
+		// the new file, next to the original.
+		Shrink(ctx context.Context, path string, maxSize int64) (string, error)
+		// Split cuts the video at path, without re-encoding, into at most
+		// MaxParts sequential parts of less than maxSize bytes each. It
+		// returns their paths in order, next to the original.
+		Split(ctx context.Context, path string, maxSize int64) ([]string, error)
+	}
+)
+
+func New() Media {
+	cfg := config.New()
+	return &media{ffmpeg: cfg.FFmpegPath, ffprobe: cfg.FFprobePath}
+}
+
+func (m *media) Duration(ctx context.Context, path string) (time.Duration, error) {
+	out, err := m.run(ctx, m.ffprobe, "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path)
+	if err != nil {
+		return 0, err
+	}
+	secs, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil || secs <= 0 {
+		return 0, fmt.Errorf("unexpected duration %q of %s", strings.TrimSpace(out), path)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+func (m *media) Probe(ctx context.Context, path string) (Info, error) {
+	out, err := m.run(ctx, m.ffprobe, "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height:format=duration", "-of", "json", path)
+	if err != nil {
+		return Info{}, err
+	}
+
+	var probe struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal([]byte(out), &probe); err != nil {
+		return Info{}, fmt.Errorf("decode ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return Info{}, fmt.Errorf("no video stream in %s", path)
+	}
+	info := Info{Width: probe.Streams[0].Width, Height: probe.Streams[0].Height}
+	if secs, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(secs * float64(time.Second))
+	}
+	return info, nil
+}
+
+func (m *media) Faststart(ctx context.Context, path string) (string, error) {
+	atEnd, err := moovAtEnd(path)
+	if err != nil || !atEnd {
+		return path, err
+	}
+
+	out := strings.TrimSuffix(path, filepath.Ext(path)) + "-faststart.mp4"
+	_, err = m.run(ctx, m.ffmpeg, "-y", "-v", "error", "-i", path, "-map", "0", "-c", "copy", "-movflags", "+faststart", out)
+	if err != nil {
+		os.Remove(out)
+		return "", err
+	}
+	return out, nil
+}
+
+func (m *media) Shrink(ctx context.Context, path string, maxSize int64) (string, error) {
+	d, err := m.Duration(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	// Aim below the limit: the encoder doesn't hit its bitrate exactly and
+	// the container adds some overhead.
+	budget := float64(maxSize*8) * 0.9 / d.Seconds()
+	out := strings.TrimSuffix(path, filepath.Ext(path)) + "-small.mp4"
+	for _, share := range []float64{1, 0.8} {
+		video := int64(budget*share) - audioBitrate
+		if video < minVideoBitrate {
+			return "", fmt.Errorf("%w at %d kbit/s: %s long", ErrTooLong, video/1000, d.Round(time.Second))
+		}
+		_, err := m.run(ctx, m.ffmpeg, "-y", "-v", "error", "-i", path,
+			"-c:v", "libx264", "-preset", "veryfast",
+			"-b:v", strconv.FormatInt(video, 10),
+			"-maxrate", strconv.FormatInt(video, 10),
+			"-bufsize", strconv.FormatInt(2*video, 10),
+			"-c:a", "aac", "-b:a", strconv.Itoa(audioBitrate),
+			"-movflags", "+faststart",
+			out)
+		if err != nil {
+			os.Remove(out)
+			return "", err
+		}
+		info, err := os.Stat(out)
+		if err != nil {
+			return "", err
+		}
+		if info.Size() < maxSize {
+			return out, nil
+		}
+	}
+	os.Remove(out)
+	return "", fmt.Errorf("%w: still over %d bytes after re-encoding", ErrTooLong, maxSize)
+}
+
+func (m *media) Split(ctx context.Context, path string, maxSize int64) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	d, err := m.Duration(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	count := partCount(info.Size(), maxSize)
+	if count > MaxParts {
+		return nil, fmt.Errorf("%w in %d parts", ErrTooLong, MaxParts)
+	}
+	segment := d / time.Duration(count)
+
+	prefix := strings.TrimSuffix(path, filepath.Ext(path)) + "-part"
+	_, err = m.run(ctx, m.ffmpeg, "-y", "-v", "error", "-i", path,
+		"-map", "0", "-c", "copy",
+		"-f", "segment", "-segment_time", strconv.FormatFloat(segment.Seconds(), 'f', 3, 64),
+		"-reset_timestamps", "1", "-segment_format_options", "movflags=+faststart",
+		prefix+"%03d.mp4")
+	parts, _ := filepath.Glob(prefix + "[0-9][0-9][0-9].mp4")
+	if err == nil {
+		err = checkParts(parts, maxSize)
+	}
+	if err != nil {
+		for _, p := range parts {
+			os.Remove(p)
+		}
+		return nil, err
+	}
+	return parts, nil
+}
+
+// partCount is the number of parts to cut a file of size bytes into so that
+// each stays under maxSize. Parts are cut on keyframes, so leave some room
+// above their size.
+func partCount(size, maxSize int64) int {
+	return int(size*10/(maxSize*8)) + 1
+}
+
+// checkParts fails unless there are 1 to MaxParts parts, each under maxSize.
+func checkParts(parts []string, maxSize int64) error {
+	if len(parts) == 0 || len(parts) > MaxParts {
+		return fmt.Errorf("%w: split into %d parts", ErrTooLong, len(parts))
+	}
+	for _, p := range parts {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if info.Size() >= maxSize {
+			return fmt.Errorf("%w: part %s has %d bytes", ErrTooLong, filepath.Base(p), info.Size())
+		}
+	}
+	return nil
+}
+
+// run executes name with args and returns its standard output.
+func (m *media) run(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w: %s", filepath.Base(name), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
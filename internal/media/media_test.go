@@ -0,0 +1,73 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const mb = 1024 * 1024
+
+func TestPartCount(t *testing.T) {
+	tests := []struct {
+		size int64
+		want int
+	}{
+		{10 * mb, 1},
+		{39 * mb, 1},
+		// Parts get 20% of room over the limit for the keyframes.
+		{40 * mb, 2},
+		{49 * mb, 2},
+		{150 * mb, 4},
+		{359 * mb, 9},
+		{360 * mb, 10},
+		{400 * mb, 11},
+	}
+	for _, tt := range tests {
+		if got := partCount(tt.size, 50*mb); got != tt.want {
+			t.Errorf("%d MB: %d parts, want %d", tt.size/mb, got, tt.want)
+		}
+	}
+}
+
+func writeParts(t *testing.T, sizes ...int64) []string {
+	t.Helper()
+	dir := t.TempDir()
+	parts := make([]string, len(sizes))
+	for i, size := range sizes {
+		parts[i] = filepath.Join(dir, fmt.Sprintf("clip-part%03d.mp4", i))
+		if err := os.WriteFile(parts[i], nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(parts[i], size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return parts
+}
+
+func TestCheckParts(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes []int64
+		ok    bool
+	}{
+		{"under the limit", []int64{40 * mb, 40 * mb, 10 * mb}, true},
+		{"no parts", nil, false},
+		{"part at the limit", []int64{40 * mb, 50 * mb}, false},
+		{"too many parts", make([]int64, MaxParts+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkParts(writeParts(t, tt.sizes...), 50*mb)
+			if tt.ok && err != nil {
+				t.Errorf("got %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrTooLong) {
+				t.Errorf("got %v, want ErrTooLong", err)
+			}
+		})
+	}
+}
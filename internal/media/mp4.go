@@ -0,0 +1,57 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// moovAtEnd reports whether the MP4 file at path has its moov box after its
+// mdat box, which keeps players from starting before the whole file is
+// downloaded. Only the top level box headers are read.
+func moovAtEnd(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		offset int64
+		header [16]byte
+		mdat   bool
+	)
+	for offset < info.Size() {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return false, fmt.Errorf("read box at %d: %w", offset, err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		switch size {
+		case 0:
+			// The last box, running to the end of the file.
+			size = info.Size() - offset
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return false, fmt.Errorf("read box size at %d: %w", offset, err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 {
+			return false, fmt.Errorf("invalid box size %d at %d", size, offset)
+		}
+
+		switch string(header[4:8]) {
+		case "moov":
+			return mdat, nil
+		case "mdat":
+			mdat = true
+		}
+		offset += size
+	}
+	return false, fmt.Errorf("no moov box in %s", path)
+}
@@ -0,0 +1,188 @@
+// Package metrics holds the Prometheus metrics of the pipeline, served on
+// /metrics.
+package metrics
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "frigate_telegram"
+
+var (
+	FrigatePolls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frigate_polls_total",
+		Help:      "Polls of the Frigate API.",
+	}, []string{"instance"})
+	FrigatePollErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frigate_poll_errors_total",
+		Help:      "Polls of the Frigate API that failed.",
+	}, []string{"instance"})
+
+	EventsDetected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_detected_total",
+		Help:      "New events notified.",
+	}, []string{"camera", "label"})
+	EventsFiltered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_filtered_total",
+		Help:      "Events dropped by the configured filters.",
+	}, []string{"camera", "label"})
+	EventsDeduped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_deduped_total",
+		Help:      "Events seen again and skipped.",
+	}, []string{"camera", "label"})
+
+	QueuePublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_published_total",
+		Help:      "Messages published to the queue.",
+	})
+	QueueAcked = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_acked_total",
+		Help:      "Messages handled successfully.",
+	})
+	QueueNacked = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_nacked_total",
+		Help:      "Messages whose handler failed.",
+	})
+	QueueRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_retries_total",
+		Help:      "Failed messages scheduled for a retry.",
+	})
+	QueueDead = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_dead_lettered_total",
+		Help:      "Failed messages moved to the dead letter queue.",
+	})
+	QueueDelayed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_delayed_total",
+		Help:      "Messages not ready yet, delivered again later.",
+	})
+
+	ClipDownloadBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "clip_download_bytes",
+		Help:      "Size of the clips downloaded from Frigate.",
+		Buckets:   prometheus.ExponentialBuckets(256*1024, 2, 10), // 256KB to 128MB
+	}, []string{"camera"})
+	ClipDownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "clip_download_duration_seconds",
+		Help:      "Time taken to download clips from Frigate.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"camera"})
+
+	S3UploadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_upload_bytes_total",
+		Help:      "Bytes uploaded to the bucket.",
+	})
+	S3UploadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "s3_upload_duration_seconds",
+		Help:      "Time taken to upload clips to the bucket.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+	S3UploadFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_upload_failures_total",
+		Help:      "Uploads to the bucket that failed.",
+	})
+
+	ClipsOversize = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clips_oversize_total",
+		Help:      "Clips over the Telegram limit, by FRIGATE_OVERSIZE mode and result (sent, or fallback to the bucket).",
+	}, []string{"mode", "result"})
+	ClipProcessDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "clip_process_duration_seconds",
+		Help:      "Time taken by ffmpeg to make clips fit the Telegram limit.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	}, []string{"mode"})
+
+	TelegramDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_request_duration_seconds",
+		Help:      "Latency of the Telegram Bot API, by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+	TelegramRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_rate_limited_total",
+		Help:      "Telegram requests refused with 429 Too Many Requests.",
+	}, []string{"method"})
+	TelegramRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_retries_total",
+		Help:      "Telegram requests sent again after a 429, 5xx or network error.",
+	}, []string{"method"})
+	TelegramQueueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_queue_wait_seconds",
+		Help:      "Time Telegram requests waited for their turn under the rate limits.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	})
+	TelegramAlbums = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_album_size",
+		Help:      "Snapshots sent together, 1 when a snapshot was sent alone.",
+		Buckets:   prometheus.LinearBuckets(1, 1, 10),
+	})
+
+	LeaderIsLeader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader_is_leader",
+		Help:      "1 while this replica leads, 0 otherwise.",
+	})
+	LeaderChanges = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "leader_changes_total",
+		Help:      "Times this replica gained or lost the leadership.",
+	})
+)
+
+// Handler serves the metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// TelegramClient observes the Bot API calls made through its client. Long
+// polling for updates is left out, its latency is the poll timeout.
+type TelegramClient struct {
+	Client *http.Client
+}
+
+func (c *TelegramClient) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	start := time.Now()
+	resp, err := c.Client.Do(req)
+	if method == "getUpdates" {
+		return resp, err
+	}
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			TelegramRateLimited.WithLabelValues(method).Inc()
+		}
+	}
+	TelegramDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
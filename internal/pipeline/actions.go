@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/telegram"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// ActionPrefix starts the callback data of the event buttons, which is
+// "fa:<action>:<event ref>". Telegram caps callback data at 64 bytes.
+const (
+	ActionPrefix  = "fa:"
+	maxActionData = 64
+)
+
+// actions lists the buttons TELEGRAM_ACTIONS may enable, in display order.
+var actions = []struct {
+	name, code, text string
+}{
+	{"false_positive", "fp", "False positive"},
+	{"sub_label", "sub", "Sub label"},
+	{"retain", "keep", "Retain"},
+	{"delete", "del", "Delete"},
+	{"plus", "plus", "Frigate+"},
+}
+
+// eventKeyboard returns the buttons acting on the event ref in Frigate, or
+// nil when they are disabled or ref doesn't fit in the callback data.
+func eventKeyboard(cfg *config.Config, ref EventRef) models.ReplyMarkup {
+	var row []models.InlineKeyboardButton
+	for _, a := range actions {
+		if !enabled(cfg, a.name) || (a.name == "sub_label" && len(cfg.TelegramSubLabels) == 0) {
+			continue
+		}
+		row = append(row, models.InlineKeyboardButton{Text: a.text, CallbackData: actionData(a.code, ref)})
+	}
+	if len(row) == 0 || len(actionData("sl"+strconv.Itoa(len(cfg.TelegramSubLabels)), ref)) > maxActionData {
+		return nil
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// subLabelKeyboard lets the user pick one of cfg.TelegramSubLabels.
+func subLabelKeyboard(cfg *config.Config, ref EventRef) models.ReplyMarkup {
+	var rows [][]models.InlineKeyboardButton
+	for i, l := range cfg.TelegramSubLabels {
+		rows = append(rows, []models.InlineKeyboardButton{{Text: l, CallbackData: actionData("sl"+strconv.Itoa(i), ref)}})
+	}
+	rows = append(rows, []models.InlineKeyboardButton{{Text: "Back", CallbackData: actionData("back", ref)}})
+	return &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+func enabled(cfg *config.Config, action string) bool {
+	for _, a := range cfg.TelegramActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func actionData(code string, ref EventRef) string {
+	return ActionPrefix + code + ":" + ref.String()
+}
+
+// ActionHandler applies the event buttons to Frigate and confirms the result
+// by editing the message they belong to. Presses guard doesn't allow are
+// ignored.
+func ActionHandler(instances []Instance, guard telegram.Guard) bot.HandlerFunc {
+	cfg := config.New()
+	byName := make(map[string]Instance, len(instances))
+	for _, inst := range instances {
+		byName[inst.Name] = inst
+	}
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		query := update.CallbackQuery
+		if query == nil {
+			return
+		}
+		if !guard.Allow(update) {
+			logging.From(ctx).Warn("Ignored button from a chat or user not allowed", "user_id", query.From.ID)
+			return
+		}
+		code, rawRef, _ := strings.Cut(strings.TrimPrefix(query.Data, ActionPrefix), ":")
+		ref := ParseEventRef(rawRef)
+		ctx = logging.With(logging.WithEvent(ctx, rawRef, "", ""), "action", code, "user", query.From.Username)
+		msg := query.Message.Message
+
+		answer := func(text string) {
+			_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID, Text: text})
+			if err != nil {
+				logging.From(ctx).Error("Failed to answer button", "err", err)
+			}
+		}
+
+		inst, ok := byName[ref.Instance]
+		if !ok || msg == nil {
+			answer("Unknown event " + rawRef)
+			return
+		}
+
+		switch code {
+		case "sub", "back":
+			markup := eventKeyboard(cfg, ref)
+			if code == "sub" {
+				markup = subLabelKeyboard(cfg, ref)
+			}
+			_, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+				ChatID:      msg.Chat.ID,
+				MessageID:   msg.ID,
+				ReplyMarkup: markup,
+			})
+			if err != nil {
+				logging.From(ctx).Error("Failed to switch buttons", "err", err)
+			}
+			answer("")
+			return
+		}
+
+		var (
+			done string
+			err  error
+		)
+		switch code {
+		case "fp":
+			done, err = "Marked as false positive", inst.Frigate.FalsePositive(ctx, ref.ID)
+		case "keep":
+			done, err = "Retained indefinitely", inst.Frigate.Retain(ctx, ref.ID)
+		case "del":
+			done, err = "Deleted from Frigate", inst.Frigate.DeleteEvent(ctx, ref.ID)
+		case "plus":
+			done, err = "Submitted to Frigate+", inst.Frigate.SubmitPlus(ctx, ref.ID)
+		default:
+			i, aerr := strconv.Atoi(strings.TrimPrefix(code, "sl"))
+			if !strings.HasPrefix(code, "sl") || aerr != nil || i < 0 || i >= len(cfg.TelegramSubLabels) {
+				answer("Unknown action")
+				return
+			}
+			subLabel := cfg.TelegramSubLabels[i]
+			done, err = "Sub label set to "+subLabel, inst.Frigate.SetSubLabel(ctx, ref.ID, subLabel)
+		}
+		if err != nil {
+			logging.From(ctx).Error("Action failed", "err", err)
+			answer("Failed: " + err.Error())
+			return
+		}
+		answer(done)
+		logging.From(ctx).Info("Action applied")
+
+		// Nothing is left to act on once the event is gone.
+		markup := eventKeyboard(cfg, ref)
+		if code == "del" {
+			markup = &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}}
+		}
+		if err := confirm(ctx, b, msg, fmt.Sprintf("%s by %s", done, query.From.FirstName), markup); err != nil {
+			logging.From(ctx).Error("Failed to confirm action", "err", err)
+		}
+	}
+}
+
+// confirm appends note to the text or caption of msg.
+func confirm(ctx context.Context, b *bot.Bot, msg *models.Message, note string, markup models.ReplyMarkup) error {
+	if msg.Text != "" {
+		_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      msg.Chat.ID,
+			MessageID:   msg.ID,
+			Text:        msg.Text + "\n" + note,
+			Entities:    msg.Entities,
+			ReplyMarkup: markup,
+		})
+		return err
+	}
+	_, err := b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
+		ChatID:          msg.Chat.ID,
+		MessageID:       msg.ID,
+		Caption:         msg.Caption + "\n" + note,
+		CaptionEntities: msg.CaptionEntities,
+		ReplyMarkup:     markup,
+	})
+	return err
+}
@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// maxAlbum is the most photos Telegram accepts in one media group.
+const maxAlbum = 10
+
+type (
+	albumKey struct {
+		chatID   int64
+		threadID int
+	}
+
+	albumItem struct {
+		inst    Instance
+		evt     frigate.EventStruct
+		caption string
+		sent    chan albumResult
+	}
+
+	albumResult struct {
+		messageID int
+		err       error
+	}
+
+	album struct {
+		ctx   context.Context
+		items []*albumItem
+	}
+
+	// albumQueue collects the snapshots bound for the same topic within
+	// TELEGRAM_ALBUM_WINDOW, so that a burst of events (rain, headlights)
+	// is sent as a few albums rather than a message per event.
+	albumQueue struct {
+		mu      sync.Mutex
+		pending map[albumKey]*album
+	}
+)
+
+var albums = &albumQueue{pending: make(map[albumKey]*album)}
+
+// queueSnapshot sends the snapshot of evt like sendSnapshot, after waiting
+// for other snapshots to the same topic to send them together. Snapshots
+// sent in an album lose their action keyboard, which media groups can't
+// carry. It returns the ID of the message showing the snapshot.
+func queueSnapshot(ctx context.Context, cfg *config.Config, b *bot.Bot, inst Instance, evt frigate.EventStruct, caption string) (int, error) {
+	if cfg.TelegramAlbumWindow <= 0 {
+		return sendSnapshot(ctx, cfg, b, inst, evt, caption)
+	}
+
+	key := albumKey{chatID: inst.ChatID, threadID: inst.ThreadID(evt.Camera)}
+	item := &albumItem{inst: inst, evt: evt, caption: caption, sent: make(chan albumResult, 1)}
+
+	albums.mu.Lock()
+	a, ok := albums.pending[key]
+	if !ok {
+		a = &album{ctx: context.WithoutCancel(ctx)}
+		albums.pending[key] = a
+		time.AfterFunc(time.Duration(cfg.TelegramAlbumWindow)*time.Second, func() {
+			albums.flush(cfg, b, key, a)
+		})
+	}
+	a.items = append(a.items, item)
+	full := len(a.items) == maxAlbum
+	if full {
+		delete(albums.pending, key)
+	}
+	albums.mu.Unlock()
+
+	if full {
+		go albums.send(cfg, b, key, a)
+	}
+	r := <-item.sent
+	return r.messageID, r.err
+}
+
+// flush sends a once its window is over, unless it filled up before.
+func (q *albumQueue) flush(cfg *config.Config, b *bot.Bot, key albumKey, a *album) {
+	q.mu.Lock()
+	current := q.pending[key] == a
+	if current {
+		delete(q.pending, key)
+	}
+	q.mu.Unlock()
+
+	if current {
+		q.send(cfg, b, key, a)
+	}
+}
+
+func (q *albumQueue) send(cfg *config.Config, b *bot.Bot, key albumKey, a *album) {
+	metrics.TelegramAlbums.Observe(float64(len(a.items)))
+	if len(a.items) == 1 {
+		it := a.items[0]
+		id, err := sendSnapshot(a.ctx, cfg, b, it.inst, it.evt, it.caption)
+		it.sent <- albumResult{messageID: id, err: err}
+		return
+	}
+
+	var (
+		group   []models.InputMedia
+		members []*albumItem
+		alone   []*albumItem
+	)
+	for _, it := range a.items {
+		fileName, err := saveSnapshot(a.ctx, cfg, it.inst, it.evt)
+		if err != nil {
+			alone = append(alone, it)
+			continue
+		}
+		defer os.Remove(fileName)
+		file, err := os.Open(fileName)
+		if err != nil {
+			alone = append(alone, it)
+			continue
+		}
+		defer file.Close()
+
+		group = append(group, &models.InputMediaPhoto{
+			Media:           "attach://" + filepath.Base(fileName),
+			MediaAttachment: file,
+			Caption:         it.caption,
+			ParseMode:       it.inst.Captions.ParseMode(),
+		})
+		members = append(members, it)
+	}
+	if len(members) == 1 {
+		// A media group needs two items at least.
+		alone, members = append(alone, members[0]), nil
+	}
+
+	// Events without a usable snapshot go one by one, sendSnapshot falls
+	// back to a text message for them.
+	for _, it := range alone {
+		id, err := sendSnapshot(a.ctx, cfg, b, it.inst, it.evt, it.caption)
+		it.sent <- albumResult{messageID: id, err: err}
+	}
+	if len(members) == 0 {
+		return
+	}
+
+	msgs, err := b.SendMediaGroup(a.ctx, &bot.SendMediaGroupParams{
+		ChatID:          key.chatID,
+		MessageThreadID: key.threadID,
+		Media:           group,
+	})
+	if err != nil {
+		logging.From(a.ctx).Error("Failed to send album", "snapshots", len(members), "err", err)
+	}
+	for i, it := range members {
+		r := albumResult{err: err}
+		if err == nil && i < len(msgs) {
+			r.messageID = msgs[i].ID
+		}
+		it.sent <- r
+	}
+}
@@ -0,0 +1,392 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/alert"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/caption"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/media"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/queue"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/s3"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/state"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// maxSize is the largest clip sent to Telegram, a MB short of
+// TELEGRAM_MAX_UPLOAD for the rest of the request.
+func maxSize(cfg *config.Config) int64 {
+	return int64(cfg.TelegramMaxUpload-1) * 1024 * 1024
+}
+
+type (
+	clipWorker struct {
+		cfg       *config.Config
+		instances map[string]Instance
+		s3Client  s3.S3
+		bot       *bot.Bot
+		tracker   state.Tracker
+		alerts    alert.Reporter
+		media     media.Media
+	}
+
+	// ClipWorker delivers the clip of a finished event. Handle is meant to be
+	// used as a queue handler: it returns nil only once the clip reached
+	// Telegram (or S3), and marks errors that won't go away as permanent.
+	ClipWorker interface {
+		Handle(ctx context.Context, msg []byte) error
+		// Dead is the dead letter handler: it marks the event failed, so
+		// that it is no longer pending, and reports it to the error chat.
+		Dead(ctx context.Context, msg []byte, err error)
+	}
+)
+
+func NewClipWorker(instances []Instance, s3Client s3.S3, b *bot.Bot, tracker state.Tracker, alerts alert.Reporter) ClipWorker {
+	byName := make(map[string]Instance, len(instances))
+	for _, inst := range instances {
+		byName[inst.Name] = inst
+	}
+	return &clipWorker{cfg: config.New(), instances: byName, s3Client: s3Client, bot: b, tracker: tracker, alerts: alerts, media: media.New()}
+}
+
+// Handle implements ClipWorker.
+func (w *clipWorker) Handle(ctx context.Context, msg []byte) error {
+	key := string(msg)
+	ctx = logging.WithEvent(ctx, key, "", "")
+
+	rec, err := w.tracker.Get(ctx, key)
+	if err != nil {
+		logging.From(ctx).Error("Failed to read event state", "err", err)
+	}
+	if rec != nil {
+		ctx = logging.WithEvent(ctx, "", rec.Camera, rec.Label)
+	}
+	logging.From(ctx).Info("Delivering clip")
+	if rec != nil && rec.State.Terminal() {
+		logging.From(ctx).Info("Event already settled, skipping", "state", rec.State)
+		return nil
+	}
+
+	err = w.deliver(ctx, ParseEventRef(key))
+	if errors.Is(err, errTelegram) {
+		w.alerts.Fail(ctx, alert.Telegram, err)
+	} else if err == nil {
+		w.alerts.Recover(ctx, alert.Telegram)
+	}
+	switch {
+	case err == nil:
+	case queue.IsDelayed(err):
+		logging.From(ctx).Info("Clip not ready yet", "reason", err)
+		// Show progress, so that Resume doesn't publish it again.
+		if terr := w.tracker.Annotate(ctx, key, state.Info{}); terr != nil {
+			logging.From(ctx).Error("Failed to record event state", "err", terr)
+		}
+	case queue.IsPermanent(err):
+		// Reported to the error chat by the dead letter queue.
+		transition(ctx, w.tracker, key, state.Failed, state.Info{Err: err})
+	default:
+		if terr := w.tracker.RecordError(ctx, key, err); terr != nil {
+			logging.From(ctx).Error("Failed to record error", "err", terr)
+		}
+	}
+	return err
+}
+
+func (w *clipWorker) Dead(ctx context.Context, msg []byte, err error) {
+	key := string(msg)
+	// Permanent errors were already recorded by Handle.
+	if !queue.IsPermanent(err) {
+		transition(logging.WithEvent(ctx, key, "", ""), w.tracker, key, state.Failed, state.Info{Err: err})
+	}
+	w.alerts.Fail(ctx, alert.DeadLetter, fmt.Errorf("gave up on event %s: %w", key, err))
+}
+
+// clip describes the recording to deliver, for an event or a review segment.
+type clip struct {
+	key    string
+	camera string
+	label  string
+	start  float64
+	// stage and data make the caption of the clip.
+	stage caption.Stage
+	data  caption.Data
+	// snapshot is the event whose snapshot stands for the clip, if any.
+	snapshot *frigate.EventStruct
+}
+
+func (w *clipWorker) deliver(ctx context.Context, ref EventRef) error {
+	inst, ok := w.instances[ref.Instance]
+	if !ok {
+		return queue.Permanent(fmt.Errorf("event %s belongs to unknown Frigate instance %q", ref, ref.Instance))
+	}
+
+	var (
+		c            *clip
+		filePathClip string
+		err          error
+		start        = time.Now()
+	)
+	if ref.Review {
+		c, filePathClip, err = w.fetchReview(ctx, inst, ref)
+	} else {
+		c, filePathClip, err = w.fetchEvent(ctx, inst, ref)
+	}
+	if err != nil || c == nil {
+		return err
+	}
+	defer os.Remove(filePathClip)
+	transition(ctx, w.tracker, c.key, state.ClipDownloaded, state.Info{})
+
+	fileInfo, err := os.Stat(filePathClip)
+	if err != nil {
+		return fmt.Errorf("stat clip of %s: %w", c.key, err)
+	}
+	metrics.ClipDownloadDuration.WithLabelValues(c.camera).Observe(time.Since(start).Seconds())
+	metrics.ClipDownloadBytes.WithLabelValues(c.camera).Observe(float64(fileInfo.Size()))
+
+	if fileInfo.Size() > maxSize(w.cfg) {
+		return w.sendOversize(ctx, inst, c, filePathClip)
+	}
+	return w.sendTelegram(ctx, inst, c, filePathClip)
+}
+
+// fetchEvent downloads the clip of a finished event. It returns a nil clip
+// when there is nothing left to send.
+func (w *clipWorker) fetchEvent(ctx context.Context, inst Instance, ref EventRef) (*clip, string, error) {
+	key, eventID := ref.String(), ref.ID
+
+	event, inProgress, err := inst.Frigate.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, "", frigateError(fmt.Errorf("get event %s: %w", eventID, err))
+	}
+	if inProgress {
+		return nil, "", queue.Delay(fmt.Errorf("event %s is still in progress", eventID))
+	}
+	if err := w.clipReady(*event.EndTime); err != nil {
+		return nil, "", queue.Delay(fmt.Errorf("clip of event %s %w", eventID, err))
+	}
+
+	if !event.HasClip {
+		logging.From(ctx).Info("Event has no clip, nothing to deliver")
+		transition(ctx, w.tracker, key, state.Delivered, state.Info{})
+		return nil, "", nil
+	}
+
+	c := &clip{
+		key:      key,
+		camera:   event.Camera,
+		label:    event.Label,
+		start:    event.StartTime,
+		stage:    caption.Clip,
+		data:     eventData(*event),
+		snapshot: event,
+	}
+
+	filePathClip, err := inst.Frigate.SaveClip(ctx, *event)
+	if errors.Is(err, frigate.ErrNotFound) {
+		// Frigate dropped the recording, the snapshot is all we can send.
+		w.alerts.Fail(ctx, alert.ClipGone, fmt.Errorf("clip of event %s (%s) is gone, sending the snapshot only", key, event.Camera))
+		return nil, "", w.sendSnapshotOnly(ctx, inst, c)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("download clip of event %s: %w", eventID, err)
+	}
+	return c, filePathClip, nil
+}
+
+// fetchReview downloads the recordings covering a finished review segment.
+func (w *clipWorker) fetchReview(ctx context.Context, inst Instance, ref EventRef) (*clip, string, error) {
+	review, inProgress, err := inst.Frigate.GetReview(ctx, ref.ID)
+	if err != nil {
+		return nil, "", frigateError(fmt.Errorf("get review %s: %w", ref.ID, err))
+	}
+	if inProgress {
+		return nil, "", queue.Delay(fmt.Errorf("review %s is still in progress", ref.ID))
+	}
+	if err := w.clipReady(*review.EndTime); err != nil {
+		return nil, "", queue.Delay(fmt.Errorf("recordings of review %s %w", ref.ID, err))
+	}
+
+	c := &clip{
+		key:      ref.String(),
+		camera:   review.Camera,
+		label:    strings.Join(review.Labels(), "-"),
+		start:    review.StartTime,
+		stage:    caption.Clip,
+		data:     reviewData(*review),
+		snapshot: reviewEvent(ctx, inst, *review),
+	}
+
+	filePathClip, err := inst.Frigate.SaveRecording(ctx, review.Camera, review.StartTime, *review.EndTime)
+	if errors.Is(err, frigate.ErrNotFound) {
+		w.alerts.Fail(ctx, alert.ClipGone, fmt.Errorf("recordings of review %s (%s) are gone, sending the snapshot only", c.key, review.Camera))
+		return nil, "", w.sendSnapshotOnly(ctx, inst, c)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("download recordings of review %s: %w", ref.ID, err)
+	}
+	return c, filePathClip, nil
+}
+
+// clipReady fails while Frigate may still be writing the recording that
+// ended at end.
+func (w *clipWorker) clipReady(end float64) error {
+	ready := time.Unix(int64(end), 0).Add(time.Duration(w.cfg.FrigateClipDelay) * time.Second)
+	if time.Now().Before(ready) {
+		return fmt.Errorf("is not ready before %s", ready.Format(time.TimeOnly))
+	}
+	return nil
+}
+
+func (w *clipWorker) sendSnapshotOnly(ctx context.Context, inst Instance, c *clip) error {
+	msgID, err := sendStill(ctx, w.cfg, w.bot, inst, c, inst.Caption(caption.Unavailable, c.data))
+	if err != nil {
+		return telegramError(err)
+	}
+	transition(ctx, w.tracker, c.key, state.Delivered, state.Info{MessageID: msgID})
+	deletePreview(ctx, w.bot, inst, c.key)
+	return nil
+}
+
+func (w *clipWorker) sendBucket(ctx context.Context, inst Instance, c *clip, filePathClip string) error {
+	s3Key, link, err := uploadClip(ctx, w.cfg, w.s3Client, w.alerts, inst, c, filePathClip)
+	if err != nil {
+		return err
+	}
+	transition(ctx, w.tracker, c.key, state.Uploaded, state.Info{S3Key: s3Key})
+
+	data := c.data
+	data.Link = link
+	msgID, err := sendStill(ctx, w.cfg, w.bot, inst, c, inst.Caption(caption.Link, data))
+	if err != nil {
+		return telegramError(err)
+	}
+	transition(ctx, w.tracker, c.key, state.Delivered, state.Info{MessageID: msgID})
+	deletePreview(ctx, w.bot, inst, c.key)
+	return nil
+}
+
+// uploadClip stores a clip too big for Telegram in the bucket. It returns
+// the S3 key and a presigned link to it.
+func uploadClip(ctx context.Context, cfg *config.Config, s3Client s3.S3, alerts alert.Reporter, inst Instance, c *clip, filePathClip string) (string, string, error) {
+	file, err := os.Open(filePathClip)
+	if err != nil {
+		return "", "", fmt.Errorf("open clip: %w", err)
+	}
+	defer file.Close()
+
+	s3File, err := s3.Files(s3Client.GetClient())
+	if err != nil {
+		return "", "", fmt.Errorf("s3 file: %w", err)
+	}
+
+	s3File.SetFile(ctx, file)
+	s3File.SetBucket(ctx, cfg.BUCKET_NAME)
+	timeHumanReadable := time.Unix(int64(c.start), 0).Format("2006-01-02 15:04:05")
+	s3Key := c.camera + "/" + timeHumanReadable + "-" + c.label + ".mp4"
+	if inst.Name != "" {
+		s3Key = inst.Name + "/" + s3Key
+	}
+	s3File.SetDestinatoin(ctx, s3Key)
+	start := time.Now()
+	if err := s3File.Upload(ctx); err != nil {
+		metrics.S3UploadFailures.Inc()
+		err = fmt.Errorf("upload clip: %w", err)
+		alerts.Fail(ctx, alert.S3, err)
+		return "", "", err
+	}
+	alerts.Recover(ctx, alert.S3)
+	metrics.S3UploadDuration.Observe(time.Since(start).Seconds())
+	if fileInfo, err := file.Stat(); err == nil {
+		metrics.S3UploadBytes.Add(float64(fileInfo.Size()))
+	}
+	return s3Key, s3File.GetPresignedURL(ctx), nil
+}
+
+func (w *clipWorker) sendTelegram(ctx context.Context, inst Instance, c *clip, filePathClip string) error {
+	sendPath, info := prepareVideo(ctx, w.media, filePathClip)
+	if sendPath != filePathClip {
+		defer os.Remove(sendPath)
+	}
+	file, err := os.Open(sendPath)
+	if err != nil {
+		return fmt.Errorf("open clip: %w", err)
+	}
+	defer file.Close()
+
+	telegramMessage := &bot.SendVideoParams{
+		ChatID:            inst.ChatID,
+		MessageThreadID:   inst.ThreadID(c.camera),
+		Video:             &models.InputFileUpload{Filename: filepath.Base(filePathClip), Data: file},
+		Width:             info.Width,
+		Height:            info.Height,
+		Duration:          int(info.Duration.Round(time.Second).Seconds()),
+		SupportsStreaming: true,
+		Caption:           inst.Caption(c.stage, c.data),
+		ParseMode:         inst.Captions.ParseMode(),
+	}
+	if thumbnail := saveVideoThumbnail(ctx, w.cfg, inst, c); thumbnail != "" {
+		defer os.Remove(thumbnail)
+		thumbFile, err := os.Open(thumbnail)
+		if err == nil {
+			defer thumbFile.Close()
+			telegramMessage.Thumbnail = &models.InputFileUpload{Filename: filepath.Base(thumbnail), Data: thumbFile}
+		}
+	}
+	if c.snapshot != nil {
+		telegramMessage.ReplyMarkup = eventKeyboard(w.cfg, EventRef{Instance: inst.Name, ID: c.snapshot.ID})
+	}
+	msg, err := w.bot.SendVideo(ctx, telegramMessage)
+	if err != nil {
+		return telegramError(err)
+	}
+	transition(ctx, w.tracker, c.key, state.Delivered, state.Info{MessageID: msg.ID})
+	deletePreview(ctx, w.bot, inst, c.key)
+	return nil
+}
+
+// frigateError marks errors Frigate won't recover from (deleted event,
+// unexpected payload) as permanent.
+func frigateError(err error) error {
+	var decodeErr *frigate.DecodeError
+	if errors.Is(err, frigate.ErrNotFound) || errors.As(err, &decodeErr) {
+		return queue.Permanent(err)
+	}
+	return err
+}
+
+// errTelegram wraps the errors of Telegram sends.
+var errTelegram = errors.New("send to telegram")
+
+// telegramError marks errors that a retry can't fix (bad request, bot kicked
+// from the chat, wrong token, unknown chat) as permanent. Rate limits and
+// network errors stay retryable.
+func telegramError(err error) error {
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%w: %w", errTelegram, err)
+	if errors.Is(err, bot.ErrorBadRequest) || errors.Is(err, bot.ErrorForbidden) ||
+		errors.Is(err, bot.ErrorUnauthorized) || errors.Is(err, bot.ErrorNotFound) {
+		return queue.Permanent(err)
+	}
+	return err
+}
+
+// transition records a step of the event lifecycle. The state is only
+// informative, so failing to store it doesn't stop the pipeline.
+func transition(ctx context.Context, tracker state.Tracker, eventID string, next state.State, info state.Info) {
+	if err := tracker.Transition(ctx, eventID, next, info); err != nil {
+		logging.From(ctx).Warn("Failed to record event state", "state", next, "err", err)
+	}
+}
@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/alert"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/queue"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/state"
+)
+
+// fakeFrigate answers GetEvent with replies, one per call, repeating the
+// last one.
+type fakeFrigate struct {
+	frigate.Frigate
+	mu      sync.Mutex
+	replies []eventReply
+}
+
+type eventReply struct {
+	event      *frigate.EventStruct
+	inProgress bool
+	err        error
+}
+
+func (f *fakeFrigate) GetEvent(context.Context, string) (*frigate.EventStruct, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.replies[0]
+	if len(f.replies) > 1 {
+		f.replies = f.replies[1:]
+	}
+	return r.event, r.inProgress, r.err
+}
+
+type fakeTracker struct {
+	mu     sync.Mutex
+	states []state.State
+	errors int
+}
+
+func (f *fakeTracker) Transition(_ context.Context, _ string, next state.State, _ state.Info) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states = append(f.states, next)
+	return nil
+}
+
+func (f *fakeTracker) RecordError(context.Context, string, error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors++
+	return nil
+}
+
+func (f *fakeTracker) Annotate(context.Context, string, state.Info) error { return nil }
+func (f *fakeTracker) Get(context.Context, string) (*state.Record, error) { return nil, nil }
+func (f *fakeTracker) Pending(context.Context) ([]state.Record, error)    { return nil, nil }
+
+func (f *fakeTracker) recorded() ([]state.State, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.states), f.errors
+}
+
+type fakeAlerts struct {
+	mu    sync.Mutex
+	fails []string
+}
+
+func (f *fakeAlerts) Fail(_ context.Context, class string, _ error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fails = append(f.fails, class)
+}
+
+func (f *fakeAlerts) Recover(context.Context, string) {}
+
+func (f *fakeAlerts) failed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.fails)
+}
+
+// TestClipWorkerQueue runs the clip worker behind the embedded queue, with
+// no retries left, so that only "not ready yet" is redelivered.
+func TestClipWorkerQueue(t *testing.T) {
+	ended := float64(time.Now().Add(-time.Hour).Unix())
+	finished := &frigate.EventStruct{ID: "1", Camera: "Rua", Label: "car", EndTime: &ended}
+
+	tests := []struct {
+		name    string
+		msg     string
+		replies []eventReply
+		states  []state.State
+		errors  int
+		fails   []string
+	}{
+		{
+			name:    "not ready yet",
+			msg:     "home/1",
+			replies: []eventReply{{inProgress: true}, {inProgress: true}, {event: finished}},
+			states:  []state.State{state.Delivered},
+		},
+		{
+			name:   "unknown instance",
+			msg:    "garage/1",
+			states: []state.State{state.Failed},
+			fails:  []string{alert.DeadLetter},
+		},
+		{
+			name:    "Frigate down",
+			msg:     "home/1",
+			replies: []eventReply{{err: errors.New("connection refused")}},
+			states:  []state.State{state.Failed},
+			errors:  1,
+			fails:   []string{alert.DeadLetter},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("QUEUE_PATH", filepath.Join(t.TempDir(), "queue.db"))
+			t.Setenv("QUEUE_RETRY_DELAY", "0")
+			t.Setenv("QUEUE_MAX_RETRIES", "0")
+			q, err := queue.NewEmbedded()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inst := Instance{FrigateInstance: config.FrigateInstance{Name: "home"}, Frigate: &fakeFrigate{replies: tt.replies}}
+			tracker, alerts := &fakeTracker{}, &fakeAlerts{}
+			w := NewClipWorker([]Instance{inst}, nil, nil, tracker, alerts)
+			if err := q.Consume(w.Handle, w.Dead); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Publish(context.Background(), []byte(tt.msg)); err != nil {
+				t.Fatal(err)
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				states, _ := tracker.recorded()
+				if len(states) > 0 && len(alerts.failed()) == len(tt.fails) || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if err := q.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			states, errs := tracker.recorded()
+			if !slices.Equal(states, tt.states) || errs != tt.errors {
+				t.Errorf("recorded %v with %d errors, want %v with %d", states, errs, tt.states, tt.errors)
+			}
+			if fails := alerts.failed(); !slices.Equal(fails, tt.fails) {
+				t.Errorf("alerts %v, want %v", fails, tt.fails)
+			}
+		})
+	}
+}
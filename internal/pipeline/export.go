@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/alert"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/caption"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/s3"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/telegram"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const exportUsage = "Usage: /export [instance/]<camera> <from> <to>\n" +
+	"Times are unix timestamps, 15:04, 2006-01-02T15:04 (in TELEGRAM_TIMEZONE), RFC 3339, now, or a duration back from now like -15m."
+
+// ExportHandler answers "/export <camera> <from> <to>" with the recordings
+// of camera over that range: uploaded to Telegram when small enough, to S3
+// with a presigned link otherwise. Chats guard doesn't allow get no answer.
+func ExportHandler(instances []Instance, guard telegram.Guard, s3Client s3.S3, alerts alert.Reporter) bot.HandlerFunc {
+	cfg := config.New()
+	byName := make(map[string]Instance, len(instances))
+	for _, inst := range instances {
+		byName[inst.Name] = inst
+	}
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if update.Message == nil || !guard.Allow(update) {
+			return
+		}
+		reply := func(text string) {
+			_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          update.Message.Chat.ID,
+				MessageThreadID: update.Message.MessageThreadID,
+				Text:            text,
+			})
+			if err != nil {
+				logging.From(ctx).Error("Failed to answer /export", "err", err)
+			}
+		}
+
+		args := strings.Fields(update.Message.Text)
+		if len(args) != 4 {
+			reply(exportUsage)
+			return
+		}
+		instName, camera, ok := strings.Cut(args[1], "/")
+		if !ok {
+			instName, camera = "", args[1]
+		}
+		inst, ok := byName[instName]
+		if !ok {
+			reply("Unknown Frigate instance " + instName)
+			return
+		}
+
+		// Wall clock times are read in the zone the captions show.
+		now := time.Now().In(inst.Captions.Location())
+		from, err := parseExportTime(args[2], now)
+		if err != nil {
+			reply(err.Error() + "\n" + exportUsage)
+			return
+		}
+		to, err := parseExportTime(args[3], now)
+		if err != nil {
+			reply(err.Error() + "\n" + exportUsage)
+			return
+		}
+		switch {
+		case !to.After(from):
+			reply("The end of the range must come after its start")
+			return
+		case to.Sub(from) > time.Duration(cfg.FrigateExportMaxDuration)*time.Second:
+			reply(fmt.Sprintf("Exports are limited to %s", time.Duration(cfg.FrigateExportMaxDuration)*time.Second))
+			return
+		}
+
+		c := &clip{
+			camera: camera,
+			label:  "export",
+			start:  float64(from.Unix()),
+			stage:  caption.Export,
+			data:   caption.Data{Camera: camera, Start: from, End: to},
+		}
+		if err := export(ctx, cfg, b, s3Client, alerts, inst, c, float64(to.Unix()), update.Message); err != nil {
+			logging.From(ctx).Error("Export failed", "camera", args[1], "from", from, "to", to, "err", err)
+			reply("Export failed: " + err.Error())
+		}
+	}
+}
+
+// export downloads the recordings of c and sends them in reply to msg.
+func export(ctx context.Context, cfg *config.Config, b *bot.Bot, s3Client s3.S3, alerts alert.Reporter, inst Instance, c *clip, end float64, msg *models.Message) error {
+	filePathClip, err := inst.Frigate.SaveRecording(ctx, c.camera, c.start, end)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filePathClip)
+
+	fileInfo, err := os.Stat(filePathClip)
+	if err != nil {
+		return err
+	}
+
+	if fileInfo.Size() > maxSize(cfg) {
+		_, link, err := uploadClip(ctx, cfg, s3Client, alerts, inst, c, filePathClip)
+		if err != nil {
+			return err
+		}
+		data := c.data
+		data.Link = link
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          msg.Chat.ID,
+			MessageThreadID: msg.MessageThreadID,
+			Text:            inst.Caption(c.stage, data),
+			ParseMode:       inst.Captions.ParseMode(),
+		})
+		return err
+	}
+
+	file, err := os.Open(filePathClip)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = b.SendVideo(ctx, &bot.SendVideoParams{
+		ChatID:          msg.Chat.ID,
+		MessageThreadID: msg.MessageThreadID,
+		Video:           &models.InputFileUpload{Filename: filepath.Base(filePathClip), Data: file},
+		Caption:         inst.Caption(c.stage, c.data),
+		ParseMode:       inst.Captions.ParseMode(),
+	})
+	return err
+}
+
+// parseExportTime reads a time given to /export, relative to now. Times
+// without a zone are in the location of now.
+func parseExportTime(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(s, "-") {
+		if d, err := time.ParseDuration(s); err == nil {
+			return now.Add(d), nil
+		}
+	}
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			y, m, d := now.Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, now.Location()), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/caption"
+)
+
+func TestParseExportTime(t *testing.T) {
+	t.Setenv("TELEGRAM_TIMEZONE", "America/Sao_Paulo")
+	captions, err := caption.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := captions.Location()
+	// 02:30 UTC is still the day before in São Paulo (UTC-3).
+	now := time.Date(2024, 8, 30, 2, 30, 0, 0, time.UTC).In(loc)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"now", now},
+		{"-15m", now.Add(-15 * time.Minute)},
+		{"1725000000", time.Unix(1725000000, 0)},
+		{"14:00", time.Date(2024, 8, 29, 17, 0, 0, 0, time.UTC)},
+		{"14:10:30", time.Date(2024, 8, 29, 17, 10, 30, 0, time.UTC)},
+		{"2024-08-28T09:05", time.Date(2024, 8, 28, 12, 5, 0, 0, time.UTC)},
+		{"2024-08-28T09:05:07", time.Date(2024, 8, 28, 12, 5, 7, 0, time.UTC)},
+		{"2024-08-28T09:05:00Z", time.Date(2024, 8, 28, 9, 5, 0, 0, time.UTC)},
+		{"2024-08-28T09:05:00+02:00", time.Date(2024, 8, 28, 7, 5, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseExportTime(tt.in, now)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.in, got.UTC(), tt.want.UTC())
+		}
+	}
+
+	for _, in := range []string{"", "yesterday", "25:00", "15m"} {
+		if _, err := parseExportTime(in, now); err == nil {
+			t.Errorf("%q parsed", in)
+		}
+	}
+
+	// The caption shows the times as they were typed.
+	from, _ := parseExportTime("14:00", now)
+	to, _ := parseExportTime("14:10", now)
+	want := "Rua Export: 2024-08-29 14:00:00 - 2024-08-29 14:10:00"
+	if got := captions.Render(caption.Export, caption.Data{Camera: "Rua", Start: from, End: to}); got != want {
+		t.Errorf("caption %q, want %q", got, want)
+	}
+}
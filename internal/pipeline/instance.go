@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"strings"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/caption"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
+	redis "github.com/redis/go-redis/v9"
+)
+
+type (
+	// Instance is a configured Frigate server along with its client.
+	Instance struct {
+		config.FrigateInstance
+		Frigate  frigate.Frigate
+		Captions caption.Captions
+		previews previews
+	}
+
+	// EventRef identifies an event, or a review segment when Review is set,
+	// across Frigate instances. Its string form, "<instance>/<event id>" or
+	// just the event ID for the unnamed instance, with the ID prefixed by
+	// "review:" for review segments, is what goes through the queue, the
+	// dedupe store and the event state.
+	EventRef struct {
+		Instance string
+		ID       string
+		Review   bool
+	}
+)
+
+// NewInstances creates a client for every instance in cfg.FrigateInstances.
+// Preview messages are remembered in rdb until their clip replaces them.
+func NewInstances(cfg *config.Config, rdb *redis.Client) ([]Instance, error) {
+	captions, err := caption.New()
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]Instance, 0, len(cfg.FrigateInstances))
+	for _, inst := range cfg.FrigateInstances {
+		f, err := frigate.NewFrigate(inst)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, Instance{FrigateInstance: inst, Frigate: f, Captions: captions, previews: previews{rdb: rdb}})
+	}
+	return instances, nil
+}
+
+// pollerLoop names the poller of inst on /healthz.
+func pollerLoop(inst Instance) string {
+	if inst.Name == "" {
+		return "poller"
+	}
+	return "poller:" + inst.Name
+}
+
+// Caption renders the caption of stage for a message of inst.
+func (i Instance) Caption(stage caption.Stage, data caption.Data) string {
+	data.Instance = i.Name
+	return i.Captions.Render(stage, data)
+}
+
+// eventData is what captions show of evt.
+func eventData(evt frigate.EventStruct) caption.Data {
+	data := caption.Data{
+		Camera:   evt.Camera,
+		Label:    evt.Label,
+		SubLabel: evt.SubLabelName(),
+		ID:       evt.ID,
+		Score:    evt.Score(),
+		Zones:    evt.Zones,
+		Start:    unixTime(evt.StartTime),
+	}
+	if evt.EndTime != nil {
+		data.End = unixTime(*evt.EndTime)
+	}
+	return data
+}
+
+// reviewData is what captions show of r.
+func reviewData(r frigate.ReviewStruct) caption.Data {
+	data := caption.Data{
+		Camera:   r.Camera,
+		Label:    strings.Join(r.Labels(), ","),
+		ID:       r.ID,
+		Zones:    r.Data.Zones,
+		Start:    unixTime(r.StartTime),
+		Severity: r.Severity,
+		Labels:   r.Labels(),
+	}
+	if r.EndTime != nil {
+		data.End = unixTime(*r.EndTime)
+	}
+	return data
+}
+
+func unixTime(ts float64) time.Time {
+	return time.Unix(0, int64(ts*float64(time.Second)))
+}
+
+const reviewPrefix = "review:"
+
+func (r EventRef) String() string {
+	id := r.ID
+	if r.Review {
+		id = reviewPrefix + id
+	}
+	if r.Instance == "" {
+		return id
+	}
+	return r.Instance + "/" + id
+}
+
+// ParseEventRef is the inverse of EventRef.String.
+func ParseEventRef(s string) EventRef {
+	var ref EventRef
+	if instance, id, ok := strings.Cut(s, "/"); ok {
+		ref.Instance, s = instance, id
+	}
+	ref.ID, ref.Review = strings.CutPrefix(s, reviewPrefix)
+	return ref
+}
@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/caption"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/state"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// sendOversize sends a clip over maxSize the way OversizeMode asks for its
+// camera, falling back to the bucket when ffmpeg can't make it fit.
+func (w *clipWorker) sendOversize(ctx context.Context, inst Instance, c *clip, filePathClip string) error {
+	mode := w.cfg.OversizeMode(c.camera)
+	start := time.Now()
+	var err error
+	switch mode {
+	case "transcode":
+		var small string
+		if small, err = w.media.Shrink(ctx, filePathClip, maxSize(w.cfg)); err == nil {
+			defer os.Remove(small)
+			metrics.ClipProcessDuration.WithLabelValues(mode).Observe(time.Since(start).Seconds())
+			metrics.ClipsOversize.WithLabelValues(mode, "sent").Inc()
+			return w.sendTelegram(ctx, inst, c, small)
+		}
+	case "split":
+		var parts []string
+		if parts, err = w.media.Split(ctx, filePathClip, maxSize(w.cfg)); err == nil {
+			defer func() {
+				for _, p := range parts {
+					os.Remove(p)
+				}
+			}()
+			metrics.ClipProcessDuration.WithLabelValues(mode).Observe(time.Since(start).Seconds())
+			metrics.ClipsOversize.WithLabelValues(mode, "sent").Inc()
+			return w.sendParts(ctx, inst, c, parts)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		logging.From(ctx).Warn("Uploading the clip to the bucket instead", "mode", mode, "err", err)
+		metrics.ClipsOversize.WithLabelValues(mode, "fallback").Inc()
+	}
+	return w.sendBucket(ctx, inst, c, filePathClip)
+}
+
+// sendParts sends the parts of a split clip, captioned on the first part.
+// Parts go in media groups that stay within the upload limit, so that
+// each request has the time to upload. Media groups can't carry the action
+// keyboard.
+func (w *clipWorker) sendParts(ctx context.Context, inst Instance, c *clip, parts []string) error {
+	batches, err := batchParts(parts, maxSize(w.cfg))
+	if err != nil {
+		return err
+	}
+	data := c.data
+	data.Parts = len(parts)
+	text := inst.Caption(caption.Parts, data)
+
+	firstID := 0
+	for i, batch := range batches {
+		id, err := w.sendBatch(ctx, inst, c, batch, text)
+		if err != nil {
+			return telegramError(fmt.Errorf("send clip parts %d of %d: %w", i+1, len(batches), err))
+		}
+		if i == 0 {
+			firstID = id
+		}
+		text = ""
+	}
+	transition(ctx, w.tracker, c.key, state.Delivered, state.Info{MessageID: firstID})
+	deletePreview(ctx, w.bot, inst, c.key)
+	return nil
+}
+
+// batchParts groups parts in order, at most maxAlbum per group and budget
+// bytes in all.
+func batchParts(parts []string, budget int64) ([][]string, error) {
+	var (
+		batches [][]string
+		size    int64
+	)
+	for _, p := range parts {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("stat clip part: %w", err)
+		}
+		last := len(batches) - 1
+		if last < 0 || len(batches[last]) == maxAlbum || size+fi.Size() > budget {
+			batches = append(batches, nil)
+			last, size = last+1, 0
+		}
+		batches[last] = append(batches[last], p)
+		size += fi.Size()
+	}
+	return batches, nil
+}
+
+// sendBatch sends parts as one message, a video when there is a single one,
+// with text as the caption of the first. It returns the ID of the first
+// message.
+func (w *clipWorker) sendBatch(ctx context.Context, inst Instance, c *clip, parts []string, text string) (int, error) {
+	group := make([]models.InputMedia, 0, len(parts))
+	for _, p := range parts {
+		file, err := os.Open(p)
+		if err != nil {
+			return 0, fmt.Errorf("open clip part: %w", err)
+		}
+		defer file.Close()
+
+		// Parts are cut with their index first, only the dimensions are
+		// missing.
+		info, err := w.media.Probe(ctx, p)
+		if err != nil {
+			logging.From(ctx).Warn("Sending the clip part without its dimensions", "part", filepath.Base(p), "err", err)
+		}
+		video := &models.InputMediaVideo{
+			Media:             "attach://" + filepath.Base(p),
+			MediaAttachment:   file,
+			Width:             info.Width,
+			Height:            info.Height,
+			Duration:          int(info.Duration.Round(time.Second).Seconds()),
+			SupportsStreaming: true,
+		}
+		if len(group) == 0 && text != "" {
+			video.Caption = text
+			video.ParseMode = inst.Captions.ParseMode()
+		}
+		group = append(group, video)
+	}
+
+	if len(group) == 1 {
+		video := group[0].(*models.InputMediaVideo)
+		msg, err := w.bot.SendVideo(ctx, &bot.SendVideoParams{
+			ChatID:            inst.ChatID,
+			MessageThreadID:   inst.ThreadID(c.camera),
+			Video:             &models.InputFileUpload{Filename: filepath.Base(parts[0]), Data: video.MediaAttachment},
+			Width:             video.Width,
+			Height:            video.Height,
+			Duration:          video.Duration,
+			SupportsStreaming: true,
+			Caption:           video.Caption,
+			ParseMode:         video.ParseMode,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return msg.ID, nil
+	}
+
+	msgs, err := w.bot.SendMediaGroup(ctx, &bot.SendMediaGroupParams{
+		ChatID:          inst.ChatID,
+		MessageThreadID: inst.ThreadID(c.camera),
+		Media:           group,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	return msgs[0].ID, nil
+}
@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBatchParts(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name  string
+		sizes []int64
+		want  [][]int
+	}{
+		{"one part", []int64{30 * mb}, [][]int{{0}}},
+		{"within the budget", []int64{10 * mb, 20 * mb, 19 * mb}, [][]int{{0, 1, 2}}},
+		{"over the budget", []int64{30 * mb, 30 * mb, 30 * mb, 10 * mb}, [][]int{{0}, {1}, {2, 3}}},
+		{"at the budget", []int64{25 * mb, 24 * mb, 1 * mb}, [][]int{{0, 1}, {2}}},
+		{"more than an album", make([]int64, maxAlbum+2), [][]int{{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, {10, 11}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			parts := make([]string, len(tt.sizes))
+			index := make(map[string]int)
+			for i, size := range tt.sizes {
+				parts[i] = filepath.Join(dir, fmt.Sprintf("clip-part%03d.mp4", i))
+				index[parts[i]] = i
+				if err := os.WriteFile(parts[i], nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Truncate(parts[i], size); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			batches, err := batchParts(parts, 49*mb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([][]int, len(batches))
+			for i, batch := range batches {
+				for _, p := range batch {
+					got[i] = append(got[i], index[p])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := batchParts([]string{filepath.Join(t.TempDir(), "missing.mp4")}, 49*mb); err == nil {
+		t.Error("missing part batched")
+	}
+}
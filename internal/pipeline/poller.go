@@ -0,0 +1,130 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/alert"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/caption"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/dedupe"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/health"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/queue"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/state"
+	"github.com/go-telegram/bot"
+)
+
+type (
+	poller struct {
+		cfg     *config.Config
+		inst    Instance
+		bot     *bot.Bot
+		seen    dedupe.Store
+		queue   queue.Queue
+		tracker state.Tracker
+		health  health.Health
+		alerts  alert.Reporter
+	}
+
+	// Poller watches a Frigate instance for new events, sends their snapshot
+	// and queues them for the clip worker. Only one replica should run it at a
+	// time.
+	Poller interface {
+		Run(ctx context.Context)
+	}
+)
+
+func NewPoller(inst Instance, b *bot.Bot, seen dedupe.Store, q queue.Queue, tracker state.Tracker, hc health.Health, alerts alert.Reporter) Poller {
+	return &poller{cfg: config.New(), inst: inst, bot: b, seen: seen, queue: q, tracker: tracker, health: hc, alerts: alerts}
+}
+
+// Run implements Poller. It polls until ctx is done.
+func (p *poller) Run(ctx context.Context) {
+	poll(ctx, p.inst, p.health, p.alerts, p.inst.Frigate.Events, p.notifyEvent)
+}
+
+// poll calls fetch until ctx is done and hands what it returns to notify.
+// Items of one fetch are notified side by side, so that a burst can share
+// albums. Notifications under way are finished before returning.
+func poll[T any](ctx context.Context, inst Instance, hc health.Health, alerts alert.Reporter, fetch func(context.Context) ([]T, error), notify func(context.Context, T)) {
+	loop := pollerLoop(inst)
+	defer hc.Stop(loop)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	const interval = 200 * time.Millisecond
+	wait := interval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		hc.Tick(loop)
+
+		metrics.FrigatePolls.WithLabelValues(inst.Name).Inc()
+		items, err := fetch(ctx)
+		if err != nil {
+			metrics.FrigatePollErrors.WithLabelValues(inst.Name).Inc()
+			alerts.Fail(ctx, alert.Frigate(inst.Name), err)
+			// Back off while Frigate is down instead of hammering it.
+			wait = min(wait*2, 30*time.Second)
+			logging.From(ctx).Warn("Failed to poll Frigate", "frigate", inst.URL, "retry_in", wait, "err", err)
+			continue
+		}
+		wait = interval
+		alerts.Recover(ctx, alert.Frigate(inst.Name))
+
+		for _, item := range items {
+			if ctx.Err() != nil {
+				// Shutting down, the rest is picked up on the next start.
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				notify(ctx, item)
+			}()
+		}
+	}
+}
+
+func (p *poller) notifyEvent(ctx context.Context, x frigate.EventStruct) {
+	ref := EventRef{Instance: p.inst.Name, ID: x.ID}.String()
+	ctx = logging.WithEvent(ctx, ref, x.Camera, x.Label)
+	alreadySeen, err := p.seen.SeenOrMark(ctx, ref)
+	if err != nil {
+		logging.From(ctx).Error("Failed to check dedupe store", "err", err)
+		return
+	}
+	if alreadySeen {
+		metrics.EventsDeduped.WithLabelValues(x.Camera, x.Label).Inc()
+		return
+	}
+	metrics.EventsDetected.WithLabelValues(x.Camera, x.Label).Inc()
+	ctx = logging.WithCorrelationID(ctx, "")
+	logging.From(ctx).Info("Event detected")
+	// Once marked as seen the event must reach the queue, even when
+	// shutting down. Only the delayed preview is given up.
+	work := context.WithoutCancel(ctx)
+	transition(work, p.tracker, ref, state.Detected, state.Info{Camera: x.Camera, Label: x.Label})
+
+	msgID, err := queueSnapshot(work, p.cfg, p.bot, p.inst, x, p.inst.Caption(caption.Detected, eventData(x)))
+	if err != nil {
+		logging.From(ctx).Error("Failed to send snapshot", "err", err)
+	} else {
+		transition(work, p.tracker, ref, state.SnapshotSent, state.Info{MessageID: msgID})
+	}
+	go sendPreview(ctx, p.cfg, p.bot, p.inst, p.tracker, ref, x)
+
+	if err := p.queue.Publish(work, []byte(ref)); err != nil {
+		logging.From(ctx).Error("Failed to queue event", "err", err)
+		return
+	}
+	transition(work, p.tracker, ref, state.Queued, state.Info{})
+}
@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/caption"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/state"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// previewTTL is how long a preview message is remembered, longer than the
+// queue keeps retrying a clip.
+const previewTTL = 24 * time.Hour
+
+// previews remembers the preview message of each event in Redis, under
+// frigate:preview:<key>. It doesn't depend on the event status, which can be
+// disabled, and works whichever replica delivers the clip.
+type previews struct {
+	rdb *redis.Client
+}
+
+func (p previews) put(ctx context.Context, key string, messageID int) error {
+	return p.rdb.Set(ctx, "frigate:preview:"+key, messageID, previewTTL).Err()
+}
+
+// take returns and forgets the preview message of key, 0 when there is none.
+func (p previews) take(ctx context.Context, key string) (int, error) {
+	id, err := p.rdb.GetDel(ctx, "frigate:preview:"+key).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// sendPreview waits cfg.FrigatePreviewDelay, then posts a short animation of
+// the in-progress event evt when its camera and label want one. The message
+// is deleted by deletePreview once the clip is delivered.
+func sendPreview(ctx context.Context, cfg *config.Config, b *bot.Bot, inst Instance, tracker state.Tracker, key string, evt frigate.EventStruct) {
+	format := cfg.PreviewFormat(evt.Camera, evt.Label)
+	if format == "" {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Duration(cfg.FrigatePreviewDelay) * time.Second):
+	}
+
+	fileName, err := inst.Frigate.SavePreview(ctx, evt, format)
+	if err != nil {
+		logging.From(ctx).Info("No preview for event", "err", err)
+		return
+	}
+	defer os.Remove(fileName)
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		logging.From(ctx).Error("Failed to open preview", "err", err)
+		return
+	}
+	defer file.Close()
+
+	msg, err := b.SendAnimation(ctx, &bot.SendAnimationParams{
+		ChatID:              inst.ChatID,
+		MessageThreadID:     inst.ThreadID(evt.Camera),
+		Animation:           &models.InputFileUpload{Filename: filepath.Base(fileName), Data: file},
+		Caption:             inst.Caption(caption.InProgress, eventData(evt)),
+		ParseMode:           inst.Captions.ParseMode(),
+		DisableNotification: true,
+	})
+	if err != nil {
+		logging.From(ctx).Error("Failed to send preview", "err", err)
+		return
+	}
+
+	if err := inst.previews.put(ctx, key, msg.ID); err != nil {
+		logging.From(ctx).Warn("Failed to remember preview message, it won't be deleted", "err", err)
+	}
+	if err := tracker.Annotate(ctx, key, state.Info{PreviewMessageID: msg.ID}); err != nil {
+		logging.From(ctx).Warn("Failed to record preview message", "err", err)
+	}
+}
+
+// deletePreview removes the preview message of the event, now that the clip
+// replaces it.
+func deletePreview(ctx context.Context, b *bot.Bot, inst Instance, key string) {
+	id, err := inst.previews.take(ctx, key)
+	if err != nil {
+		logging.From(ctx).Warn("Failed to look up preview", "err", err)
+		return
+	}
+	if id == 0 {
+		return
+	}
+
+	_, err = b.DeleteMessage(ctx, &bot.DeleteMessageParams{
+		ChatID:    inst.ChatID,
+		MessageID: id,
+	})
+	if err != nil {
+		logging.From(ctx).Warn("Failed to delete preview", "err", err)
+	}
+}
@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/queue"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/state"
+)
+
+// Resume publishes again the events left in an intermediate state by a
+// previous run. Events that never reached the queue are always resumed;
+// queued ones only when they made no progress for cfg.EventStateResumeAfter,
+// since their message is most likely still in the queue.
+func Resume(ctx context.Context, tracker state.Tracker, q queue.Queue) error {
+	cfg := config.New()
+	stale := time.Now().Add(-time.Duration(cfg.EventStateResumeAfter) * time.Second)
+
+	pending, err := tracker.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range pending {
+		queued := rec.State != state.Detected && rec.State != state.SnapshotSent
+		if queued && rec.UpdatedAt.After(stale) {
+			continue
+		}
+
+		ctx := logging.WithCorrelationID(logging.WithEvent(ctx, rec.EventID, rec.Camera, rec.Label), "")
+		logging.From(ctx).Info("Resuming stuck event", "state", rec.State)
+		if err := q.Publish(ctx, []byte(rec.EventID)); err != nil {
+			return err
+		}
+		if !queued {
+			transition(ctx, tracker, rec.EventID, state.Queued, state.Info{})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/alert"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/caption"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/dedupe"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/health"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/queue"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/state"
+	"github.com/go-telegram/bot"
+)
+
+// reviewPoller is the Poller of FRIGATE_MODE=reviews: it sends one
+// notification per review segment instead of one per tracked object.
+type reviewPoller struct {
+	cfg     *config.Config
+	inst    Instance
+	bot     *bot.Bot
+	seen    dedupe.Store
+	queue   queue.Queue
+	tracker state.Tracker
+	health  health.Health
+	alerts  alert.Reporter
+}
+
+func NewReviewPoller(inst Instance, b *bot.Bot, seen dedupe.Store, q queue.Queue, tracker state.Tracker, hc health.Health, alerts alert.Reporter) Poller {
+	return &reviewPoller{cfg: config.New(), inst: inst, bot: b, seen: seen, queue: q, tracker: tracker, health: hc, alerts: alerts}
+}
+
+// Run implements Poller. Review segments come from MQTT when the instance
+// has a broker configured, from the review API otherwise.
+func (p *reviewPoller) Run(ctx context.Context) {
+	// MQTT notifications under way are finished before returning.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	if p.inst.MQTTURL != "" {
+		err := p.inst.Frigate.SubscribeReviews(ctx, func(r frigate.ReviewStruct) {
+			if p.wanted(r) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					p.notify(ctx, r)
+				}()
+			}
+		})
+		if err == nil {
+			return
+		}
+		logging.From(ctx).Warn("Polling Frigate for reviews instead of MQTT", "frigate", p.inst.URL, "err", err)
+	}
+
+	reviews := func(ctx context.Context) ([]frigate.ReviewStruct, error) {
+		return p.inst.Frigate.Reviews(ctx, p.cfg.FrigateReviewSeverity)
+	}
+	poll(ctx, p.inst, p.health, p.alerts, reviews, p.notify)
+}
+
+// wanted reports whether r has one of the configured severities.
+func (p *reviewPoller) wanted(r frigate.ReviewStruct) bool {
+	for _, s := range p.cfg.FrigateReviewSeverity {
+		if r.Severity == s {
+			return true
+		}
+	}
+	metrics.EventsFiltered.WithLabelValues(r.Camera, strings.Join(r.Labels(), ",")).Inc()
+	return false
+}
+
+func (p *reviewPoller) notify(ctx context.Context, r frigate.ReviewStruct) {
+	ref := EventRef{Instance: p.inst.Name, ID: r.ID, Review: true}.String()
+	ctx = logging.WithEvent(ctx, ref, r.Camera, strings.Join(r.Labels(), ","))
+	alreadySeen, err := p.seen.SeenOrMark(ctx, ref)
+	if err != nil {
+		logging.From(ctx).Error("Failed to check dedupe store", "err", err)
+		return
+	}
+	if alreadySeen {
+		metrics.EventsDeduped.WithLabelValues(r.Camera, strings.Join(r.Labels(), ",")).Inc()
+		return
+	}
+	metrics.EventsDetected.WithLabelValues(r.Camera, strings.Join(r.Labels(), ",")).Inc()
+	ctx = logging.WithCorrelationID(ctx, "")
+	logging.From(ctx).Info("Review detected", "severity", r.Severity)
+	// Once marked as seen the review must reach the queue, even when
+	// shutting down. Only the delayed preview is given up.
+	work := context.WithoutCancel(ctx)
+	transition(work, p.tracker, ref, state.Detected, state.Info{Camera: r.Camera, Label: strings.Join(r.Labels(), ",")})
+
+	c := &clip{key: ref, camera: r.Camera, data: reviewData(r), snapshot: reviewEvent(work, p.inst, r)}
+	var msgID int
+	if c.snapshot != nil {
+		msgID, err = queueSnapshot(work, p.cfg, p.bot, p.inst, *c.snapshot, p.inst.Caption(caption.Review, c.data))
+	} else {
+		msgID, err = sendStill(work, p.cfg, p.bot, p.inst, c, p.inst.Caption(caption.Review, c.data))
+	}
+	if err != nil {
+		logging.From(ctx).Error("Failed to send snapshot", "err", err)
+	} else {
+		transition(work, p.tracker, ref, state.SnapshotSent, state.Info{MessageID: msgID})
+	}
+	if c.snapshot != nil {
+		go sendPreview(ctx, p.cfg, p.bot, p.inst, p.tracker, ref, *c.snapshot)
+	}
+
+	if err := p.queue.Publish(work, []byte(ref)); err != nil {
+		logging.From(ctx).Error("Failed to queue review", "err", err)
+		return
+	}
+	transition(work, p.tracker, ref, state.Queued, state.Info{})
+}
+
+// reviewEvent returns the first event of r, whose snapshot stands for the
+// whole segment, or nil when there is none.
+func reviewEvent(ctx context.Context, inst Instance, r frigate.ReviewStruct) *frigate.EventStruct {
+	if len(r.Data.Detections) == 0 {
+		return nil
+	}
+	evt, _, err := inst.Frigate.GetEvent(ctx, r.Data.Detections[0])
+	if err != nil {
+		logging.From(ctx).Warn("Review has no usable event", "review_id", r.ID, "err", err)
+		return nil
+	}
+	return evt
+}
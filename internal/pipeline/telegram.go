@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// sendSnapshot posts the snapshot of evt with caption to the camera topic of
+// inst. Without a usable image the caption is sent as a plain message, so
+// the notification itself is never lost. It returns the ID of the sent
+// message.
+func sendSnapshot(ctx context.Context, cfg *config.Config, b *bot.Bot, inst Instance, evt frigate.EventStruct, caption string) (int, error) {
+	keyboard := eventKeyboard(cfg, EventRef{Instance: inst.Name, ID: evt.ID})
+	fileName, err := saveSnapshot(ctx, cfg, inst, evt)
+	if err != nil {
+		logging.From(ctx).Warn("Sending event without snapshot", "err", err)
+		msg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          inst.ChatID,
+			MessageThreadID: inst.ThreadID(evt.Camera),
+			Text:            caption,
+			ParseMode:       inst.Captions.ParseMode(),
+			ReplyMarkup:     keyboard,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return msg.ID, nil
+	}
+	defer os.Remove(fileName)
+
+	filePathThumbnail, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer filePathThumbnail.Close()
+
+	// A single photo rather than a media group, which can't carry buttons.
+	msg, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:          inst.ChatID,
+		MessageThreadID: inst.ThreadID(evt.Camera),
+		Photo:           &models.InputFileUpload{Filename: filepath.Base(fileName), Data: filePathThumbnail},
+		Caption:         caption,
+		ParseMode:       inst.Captions.ParseMode(),
+		ReplyMarkup:     keyboard,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return msg.ID, nil
+}
+
+// sendStill sends the snapshot standing for c, or just the caption when
+// there is none.
+func sendStill(ctx context.Context, cfg *config.Config, b *bot.Bot, inst Instance, c *clip, caption string) (int, error) {
+	if c.snapshot != nil {
+		return sendSnapshot(ctx, cfg, b, inst, *c.snapshot, caption)
+	}
+	msg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          inst.ChatID,
+		MessageThreadID: inst.ThreadID(c.camera),
+		Text:            caption,
+		ParseMode:       inst.Captions.ParseMode(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return msg.ID, nil
+}
+
+// saveSnapshot downloads the full resolution snapshot of evt, with the
+// options configured for its camera. It falls back to the small thumbnail
+// embedded in the event when Frigate has no snapshot or fails to serve it.
+func saveSnapshot(ctx context.Context, cfg *config.Config, inst Instance, evt frigate.EventStruct) (string, error) {
+	if cfg.FrigateSnapshotEnabled && evt.HasSnapshot {
+		fileName, err := inst.Frigate.SaveSnapshot(ctx, evt, cfg.SnapshotOptions(evt.Camera))
+		if err == nil {
+			return fileName, nil
+		}
+		logging.From(ctx).Info("Falling back to the thumbnail", "err", err)
+	}
+	return inst.Frigate.SaveThumbnail(evt)
+}
@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/media"
+)
+
+// prepareVideo readies the clip at path for streaming in Telegram clients:
+// remuxed with its index first when needed, and probed for its dimensions.
+// Failures only cost the metadata. It returns the path to send, which the
+// caller removes when it differs from path.
+func prepareVideo(ctx context.Context, m media.Media, path string) (string, media.Info) {
+	sendPath, err := m.Faststart(ctx, path)
+	if err != nil {
+		logging.From(ctx).Warn("Sending the clip without faststart", "err", err)
+		sendPath = path
+	}
+	info, err := m.Probe(ctx, sendPath)
+	if err != nil {
+		logging.From(ctx).Warn("Sending the clip without its dimensions", "err", err)
+	}
+	return sendPath, info
+}
+
+// saveVideoThumbnail downloads the snapshot of c scaled down to what
+// Telegram accepts as a video thumbnail (at most 320 pixels wide and
+// 200kB). It returns "" when c has no snapshot to use.
+func saveVideoThumbnail(ctx context.Context, cfg *config.Config, inst Instance, c *clip) string {
+	if c.snapshot == nil {
+		return ""
+	}
+	evt := *c.snapshot
+	if cfg.FrigateSnapshotEnabled && evt.HasSnapshot {
+		opts := cfg.SnapshotOptions(evt.Camera)
+		opts.Set("h", "180")
+		opts.Set("quality", "70")
+		fileName, err := inst.Frigate.SaveSnapshot(ctx, evt, opts)
+		if err == nil {
+			return fileName
+		}
+		logging.From(ctx).Info("Falling back to the thumbnail", "err", err)
+	}
+	fileName, err := inst.Frigate.SaveThumbnail(evt)
+	if err != nil {
+		logging.From(ctx).Warn("Sending the clip without thumbnail", "err", err)
+		return ""
+	}
+	return fileName
+}
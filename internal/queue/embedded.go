@@ -0,0 +1,308 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	messagesBucket = []byte("messages")
+	deadBucket     = []byte("dead")
+)
+
+type (
+	// record is what the embedded queue stores for every message.
+	record struct {
+		Body          []byte    `json:"body"`
+		CorrelationID string    `json:"correlation_id,omitempty"`
+		Attempt       int       `json:"attempt"`
+		Due           time.Time `json:"due"`
+	}
+
+	embedded struct {
+		cfg *config.Config
+		db  *bolt.DB
+
+		mu       sync.Mutex
+		inflight map[uint64]bool
+
+		wake chan struct{}
+		done chan struct{}
+		wg   sync.WaitGroup
+		// ctx is given to handlers, and cancelled when Close runs out of
+		// time.
+		ctx    context.Context
+		cancel context.CancelFunc
+	}
+)
+
+// NewEmbedded opens (or creates) the on-disk queue at cfg.QueuePath. Messages
+// stay on disk until they are acked or dead-lettered, so whatever was pending
+// or in flight when the process stopped is delivered again on restart.
+func NewEmbedded() (Queue, error) {
+	cfg := config.New()
+
+	db, err := bolt.Open(cfg.QueuePath, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue %s: %w", cfg.QueuePath, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{messagesBucket, deadBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize queue: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &embedded{
+		ctx:      ctx,
+		cancel:   cancel,
+		cfg:      cfg,
+		db:       db,
+		inflight: make(map[uint64]bool),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Publish implements Queue.
+func (e *embedded) Publish(ctx context.Context, message []byte) error {
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(messagesBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return put(b, seq, record{Body: message, CorrelationID: logging.CorrelationID(ctx), Due: time.Now()})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+	metrics.QueuePublished.Inc()
+
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Consume implements Queue.
+func (e *embedded) Consume(handler Handler, onDead DeadHandler) error {
+	for i := 0; i < workers(e.cfg); i++ {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			e.work(handler, onDead)
+		}()
+	}
+	return nil
+}
+
+func (e *embedded) work(handler Handler, onDead DeadHandler) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		default:
+		}
+
+		seq, rec, err := e.claim()
+		if err != nil {
+			slog.Error("Failed to read queue", "err", err)
+		}
+		if rec == nil {
+			select {
+			case <-e.done:
+				return
+			case <-e.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		ctx := logging.WithCorrelationID(e.ctx, rec.CorrelationID)
+		err = handler(ctx, rec.Body)
+		if e.ctx.Err() != nil {
+			// Cut short by Close, the message stays due for the next run.
+			e.release(seq)
+			continue
+		}
+		if e.settle(ctx, seq, rec, err) && onDead != nil {
+			onDead(ctx, rec.Body, err)
+		}
+	}
+}
+
+// claim returns the oldest due message that no other worker is handling.
+// Records that can't be read are moved to the dead letter bucket, rather
+// than blocking the whole queue.
+func (e *embedded) claim() (uint64, *record, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var (
+		seq   uint64
+		found *record
+		bad   [][]byte
+	)
+	now := time.Now()
+	err := e.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(messagesBucket).ForEach(func(k, v []byte) error {
+			key := binary.BigEndian.Uint64(k)
+			if e.inflight[key] {
+				return nil
+			}
+			var rec record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				slog.Error("Moving unreadable message to the dead letter queue", "seq", key, "err", err)
+				bad = append(bad, append([]byte(nil), k...))
+				return nil
+			}
+			if rec.Due.After(now) || (found != nil && !rec.Due.Before(found.Due)) {
+				return nil
+			}
+			seq, found = key, &rec
+			return nil
+		})
+	})
+	if err == nil && len(bad) > 0 {
+		err = e.bury(bad)
+	}
+	if err != nil || found == nil {
+		return 0, nil, err
+	}
+
+	e.inflight[seq] = true
+	return seq, found, nil
+}
+
+// bury moves the messages stored under keys to the dead letter bucket as
+// they are.
+func (e *embedded) bury(keys [][]byte) error {
+	return e.db.Update(func(tx *bolt.Tx) error {
+		messages, dead := tx.Bucket(messagesBucket), tx.Bucket(deadBucket)
+		for _, k := range keys {
+			v := messages.Get(k)
+			if v == nil {
+				continue
+			}
+			if err := dead.Put(k, v); err != nil {
+				return err
+			}
+			if err := messages.Delete(k); err != nil {
+				return err
+			}
+			metrics.QueueDead.Inc()
+		}
+		return nil
+	})
+}
+
+// settle acks, reschedules or dead-letters a claimed message. It reports
+// whether the message was dead-lettered.
+func (e *embedded) settle(ctx context.Context, seq uint64, rec *record, herr error) bool {
+	defer e.release(seq)
+
+	moved := false
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messagesBucket)
+		if herr == nil {
+			metrics.QueueAcked.Inc()
+			return messages.Delete(key(seq))
+		}
+
+		switch failure(e.cfg, rec.Attempt+1, herr) {
+		case delay:
+			logging.From(ctx).Debug("Message is not ready yet", "message", string(rec.Body), "err", herr)
+			rec.Due = time.Now().Add(retryDelay(e.cfg))
+			return put(messages, seq, *rec)
+		case dead:
+			rec.Attempt++
+			logging.From(ctx).Warn("Message moved to the dead letter queue", "message", string(rec.Body), "attempts", rec.Attempt, "err", herr)
+			if err := messages.Delete(key(seq)); err != nil {
+				return err
+			}
+			moved = true
+			return put(tx.Bucket(deadBucket), seq, *rec)
+		}
+
+		rec.Attempt++
+		logging.From(ctx).Info("Message will be retried", "message", string(rec.Body), "attempt", rec.Attempt, "err", herr)
+		rec.Due = time.Now().Add(retryDelay(e.cfg))
+		return put(messages, seq, *rec)
+	})
+	if err != nil {
+		// The message is still stored and will be delivered again.
+		logging.From(ctx).Error("Failed to settle message", "message", string(rec.Body), "err", err)
+		return false
+	}
+	return moved
+}
+
+// Healthy implements Queue.
+func (e *embedded) Healthy() error {
+	select {
+	case <-e.done:
+		return errors.New("queue is closed")
+	default:
+	}
+	return e.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(messagesBucket) == nil {
+			return errors.New("queue bucket is missing")
+		}
+		return nil
+	})
+}
+
+// release lets other workers claim the message again.
+func (e *embedded) release(seq uint64) {
+	e.mu.Lock()
+	delete(e.inflight, seq)
+	e.mu.Unlock()
+}
+
+// Close implements Queue.
+func (e *embedded) Close(ctx context.Context) error {
+	close(e.done)
+	drain(ctx, &e.wg, e.cancel)
+	if err := e.db.Close(); err != nil {
+		return fmt.Errorf("failed to close queue: %w", err)
+	}
+	return nil
+}
+
+func key(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+func put(b *bolt.Bucket, seq uint64, rec record) error {
+	v, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return b.Put(key(seq), v)
+}
@@ -0,0 +1,269 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestEmbedded(t *testing.T, retryDelay, maxRetries string) *embedded {
+	t.Helper()
+	t.Setenv("QUEUE_PATH", filepath.Join(t.TempDir(), "queue.db"))
+	t.Setenv("QUEUE_WORKERS", "1")
+	t.Setenv("QUEUE_RETRY_DELAY", retryDelay)
+	t.Setenv("QUEUE_MAX_RETRIES", maxRetries)
+	q, err := NewEmbedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close(context.Background()) })
+	return q.(*embedded)
+}
+
+func publish(t *testing.T, e *embedded, msgs ...string) {
+	t.Helper()
+	for _, m := range msgs {
+		if err := e.Publish(context.Background(), []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// stored returns the records of bucket by sequence.
+func stored(t *testing.T, e *embedded, bucket []byte) map[uint64]record {
+	t.Helper()
+	recs := make(map[uint64]record)
+	err := e.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			var rec record
+			json.Unmarshal(v, &rec)
+			recs[binary.BigEndian.Uint64(k)] = rec
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+func TestEmbeddedClaimsInOrder(t *testing.T) {
+	e := newTestEmbedded(t, "30", "3")
+	publish(t, e, "a", "b", "c")
+
+	var got []string
+	for range 3 {
+		_, rec, err := e.claim()
+		if err != nil || rec == nil {
+			t.Fatalf("claim: %v, %v", rec, err)
+		}
+		got = append(got, string(rec.Body))
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("claimed %v, want %v", got, want)
+	}
+	if _, rec, _ := e.claim(); rec != nil {
+		t.Errorf("claimed %q while every message is in flight", rec.Body)
+	}
+}
+
+func TestEmbeddedRetryIsDueLater(t *testing.T) {
+	e := newTestEmbedded(t, "60", "3")
+	publish(t, e, "a", "b")
+
+	seq, rec, _ := e.claim()
+	start := time.Now()
+	if e.settle(context.Background(), seq, rec, errors.New("not ready")) {
+		t.Fatal("first failure was dead-lettered")
+	}
+
+	got := stored(t, e, messagesBucket)[seq]
+	if got.Attempt != 1 {
+		t.Errorf("attempt %d, want 1", got.Attempt)
+	}
+	if due := got.Due.Sub(start); due < 59*time.Second || due > 61*time.Second {
+		t.Errorf("due in %s, want 60s", due)
+	}
+
+	// b is now the only due message, a waits for its retry.
+	_, next, _ := e.claim()
+	if next == nil || string(next.Body) != "b" {
+		t.Fatalf("claimed %v, want b", next)
+	}
+	if _, rec, _ := e.claim(); rec != nil {
+		t.Errorf("claimed %q before it was due", rec.Body)
+	}
+}
+
+func TestEmbeddedDeadLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"after the last retry", errors.New("not ready"), 2},
+		{"permanent error", Permanent(errors.New("bad message")), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEmbedded(t, "0", "1")
+			publish(t, e, "a")
+
+			for i := 1; i <= tt.attempts; i++ {
+				seq, rec, _ := e.claim()
+				if rec == nil {
+					t.Fatalf("attempt %d: nothing to claim", i)
+				}
+				if moved := e.settle(context.Background(), seq, rec, tt.err); moved != (i == tt.attempts) {
+					t.Fatalf("attempt %d: dead-lettered %v", i, moved)
+				}
+			}
+			if n := len(stored(t, e, messagesBucket)); n != 0 {
+				t.Errorf("%d messages left", n)
+			}
+			dead := stored(t, e, deadBucket)
+			if len(dead) != 1 || dead[1].Attempt != tt.attempts || string(dead[1].Body) != "a" {
+				t.Errorf("dead letters %+v", dead)
+			}
+		})
+	}
+}
+
+func TestEmbeddedDelay(t *testing.T) {
+	e := newTestEmbedded(t, "60", "1")
+	publish(t, e, "a")
+
+	// Delays go on past QUEUE_MAX_RETRIES without using up attempts.
+	for i := range 3 {
+		seq, rec, _ := e.claim()
+		if rec == nil {
+			t.Fatalf("delay %d: nothing to claim", i+1)
+		}
+		start := time.Now()
+		if e.settle(context.Background(), seq, rec, Delay(errors.New("in progress"))) {
+			t.Fatalf("delay %d: dead-lettered", i+1)
+		}
+		got := stored(t, e, messagesBucket)[seq]
+		if got.Attempt != 0 {
+			t.Errorf("delay %d: attempt %d, want 0", i+1, got.Attempt)
+		}
+		if due := got.Due.Sub(start); due < 59*time.Second || due > 61*time.Second {
+			t.Errorf("delay %d: due in %s, want 60s", i+1, due)
+		}
+		if _, rec, _ := e.claim(); rec != nil {
+			t.Fatalf("delay %d: claimed %q before it was due", i+1, rec.Body)
+		}
+		// Make it due again.
+		got.Due = time.Now()
+		e.db.Update(func(tx *bolt.Tx) error { return put(tx.Bucket(messagesBucket), seq, got) })
+	}
+
+	// A real failure still counts from the first attempt.
+	seq, rec, _ := e.claim()
+	if e.settle(context.Background(), seq, rec, errors.New("not ready")) {
+		t.Fatal("first failure was dead-lettered")
+	}
+	if got := stored(t, e, messagesBucket)[seq]; got.Attempt != 1 {
+		t.Errorf("attempt %d after a failure, want 1", got.Attempt)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	t.Setenv("QUEUE_MAX_RETRIES", "2")
+	cfg := config.New()
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		want    outcome
+	}{
+		{"first failure", 1, errors.New("x"), retry},
+		{"last retry", 2, errors.New("x"), retry},
+		{"out of retries", 3, errors.New("x"), dead},
+		{"permanent", 1, Permanent(errors.New("x")), dead},
+		{"delayed", 1, Delay(errors.New("x")), delay},
+		{"delayed out of retries", 30, fmt.Errorf("wrapped: %w", Delay(errors.New("x"))), delay},
+	}
+	for _, tt := range tests {
+		if got := failure(cfg, tt.attempt, tt.err); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEmbeddedBuriesUnreadableRecords(t *testing.T) {
+	e := newTestEmbedded(t, "30", "3")
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(messagesBucket)
+		seq, _ := b.NextSequence()
+		return b.Put(key(seq), []byte("not json"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, e, "a")
+
+	_, rec, err := e.claim()
+	if err != nil || rec == nil || string(rec.Body) != "a" {
+		t.Fatalf("claim: %v, %v", rec, err)
+	}
+	if _, ok := stored(t, e, deadBucket)[1]; !ok {
+		t.Error("unreadable record was not dead-lettered")
+	}
+	if _, ok := stored(t, e, messagesBucket)[1]; ok {
+		t.Error("unreadable record is still queued")
+	}
+}
+
+func TestEmbeddedConsume(t *testing.T) {
+	e := newTestEmbedded(t, "30", "3")
+
+	var (
+		mu   sync.Mutex
+		got  []string
+		dead = make(chan string, 1)
+	)
+	handler := func(ctx context.Context, msg []byte) error {
+		mu.Lock()
+		got = append(got, string(msg))
+		mu.Unlock()
+		if string(msg) == "bad" {
+			return Permanent(errors.New("bad message"))
+		}
+		return nil
+	}
+	onDead := func(ctx context.Context, msg []byte, err error) { dead <- string(msg) }
+	if err := e.Consume(handler, onDead); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, e, "a", "bad", "b")
+
+	select {
+	case msg := <-dead:
+		if msg != "bad" {
+			t.Errorf("dead-lettered %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onDead was not called")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(stored(t, e, messagesBucket)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"a", "bad", "b"}; !slices.Equal(got, want) {
+		t.Errorf("handled %v, want %v", got, want)
+	}
+}
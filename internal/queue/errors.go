@@ -0,0 +1,48 @@
+package queue
+
+import "errors"
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying. Consume moves messages failing
+// with a permanent error straight to the dead letter queue.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was marked Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+type delayedError struct {
+	err error
+}
+
+func (e *delayedError) Error() string { return e.err.Error() }
+func (e *delayedError) Unwrap() error { return e.err }
+
+// Delay marks err as the message not being ready yet, e.g. an event still in
+// progress. Consume delivers it again after the retry delay without using up
+// one of its retries.
+func Delay(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &delayedError{err: err}
+}
+
+// IsDelayed reports whether err, or any error it wraps, was marked Delay.
+func IsDelayed(err error) bool {
+	var d *delayedError
+	return errors.As(err, &d)
+}
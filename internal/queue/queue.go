@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+)
+
+type (
+	// Handler processes one message. Returning nil acks it, any other error
+	// schedules a redelivery unless it was marked Permanent. Errors marked
+	// Delay are redelivered without counting as a failed attempt. ctx
+	// carries the correlation ID the message was published with.
+	Handler func(ctx context.Context, msg []byte) error
+
+	// DeadHandler is told about a message moved to the dead letter queue,
+	// with the error of its last attempt.
+	DeadHandler func(ctx context.Context, msg []byte, err error)
+
+	// Queue delays and retries the processing of event IDs until their clip
+	// is delivered.
+	Queue interface {
+		Publish(ctx context.Context, message []byte) error
+		// Consume runs handler on every message. onDead, if not nil, is
+		// called for the messages given up on.
+		Consume(handler Handler, onDead DeadHandler) error
+		// Healthy fails once the queue can no longer publish or consume.
+		Healthy() error
+		// Close stops consuming and waits for the handlers in flight. When
+		// ctx is done first, their context is cancelled and the messages
+		// they held are delivered again later.
+		Close(ctx context.Context) error
+	}
+)
+
+// New returns the queue backend selected by cfg.QueueBackend.
+func New() (Queue, error) {
+	cfg := config.New()
+	switch cfg.QueueBackend {
+	case "rabbitmq", "":
+		return NewRabbitMQ()
+	case "embedded":
+		return NewEmbedded()
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", cfg.QueueBackend)
+	}
+}
+
+// outcome tells what to do with a message whose handler failed on its
+// attempt-th delivery.
+type outcome int
+
+const (
+	retry outcome = iota
+	dead
+	delay
+)
+
+func failure(cfg *config.Config, attempt int, err error) outcome {
+	if IsDelayed(err) {
+		metrics.QueueDelayed.Inc()
+		return delay
+	}
+	metrics.QueueNacked.Inc()
+	if IsPermanent(err) || attempt > cfg.QueueMaxRetries {
+		metrics.QueueDead.Inc()
+		return dead
+	}
+	metrics.QueueRetries.Inc()
+	return retry
+}
+
+func workers(cfg *config.Config) int {
+	if cfg.QueueWorkers < 1 {
+		return 1
+	}
+	return cfg.QueueWorkers
+}
+
+// drain waits for wg, cancelling the handlers once ctx is done.
+func drain(ctx context.Context, wg *sync.WaitGroup, cancel context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		cancel()
+		<-done
+	}
+}
+
+func retryDelay(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.QueueRetryDelay) * time.Second
+}
@@ -0,0 +1,264 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// retryHeader counts how many times a message went through the retry
+	// queue.
+	retryHeader = "x-retry-count"
+	consumerTag = "clip-worker"
+)
+
+type rabbitMQ struct {
+	cfg     *config.Config
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	queue   amqp.Queue
+	retry   amqp.Queue
+	dead    amqp.Queue
+	// consumers counts the workers still receiving deliveries.
+	consumers atomic.Int32
+	wg        sync.WaitGroup
+	// ctx is given to handlers, and cancelled when Close runs out of time.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewRabbitMQ() (Queue, error) {
+	cfg := config.New()
+
+	conn, err := amqp.Dial(cfg.RabbitURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	q, err := ch.QueueDeclare(
+		cfg.RabbitQueue,
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	// Messages published to the retry queue expire after the retry delay and
+	// are dead-lettered back into the main queue.
+	retry, err := ch.QueueDeclare(
+		cfg.RabbitQueue+".retry",
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": q.Name,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare retry queue: %w", err)
+	}
+
+	// Messages that failed permanently or ran out of retries are parked here.
+	dead, err := ch.QueueDeclare(
+		cfg.RabbitQueue+".dead",
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare dead letter queue: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &rabbitMQ{
+		cfg:     cfg,
+		conn:    conn,
+		channel: ch,
+		queue:   q,
+		retry:   retry,
+		dead:    dead,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+func (r *rabbitMQ) Publish(ctx context.Context, message []byte) error {
+	err := r.channel.PublishWithContext(
+		ctx,
+		"",           // exchange
+		r.queue.Name, // routing key
+		false,        // mandatory
+		false,        // immediate
+		amqp.Publishing{
+			DeliveryMode:  amqp.Persistent,
+			ContentType:   "text/plain",
+			CorrelationId: logging.CorrelationID(ctx),
+			Body:          message,
+		},
+	)
+	if err == nil {
+		metrics.QueuePublished.Inc()
+	}
+	return err
+}
+
+// Consume runs handler on cfg.QueueWorkers workers. A message is acked only
+// when handler returns nil. Retryable errors send it through the retry queue,
+// permanent errors (and exhausted retries) park it in the dead letter queue.
+func (r *rabbitMQ) Consume(handler Handler, onDead DeadHandler) error {
+	workers := workers(r.cfg)
+
+	if err := r.channel.Qos(workers, 0, false); err != nil {
+		return fmt.Errorf("failed to set QoS: %w", err)
+	}
+
+	msgs, err := r.channel.Consume(
+		r.queue.Name, // queue
+		consumerTag,  // consumer
+		false,        // auto-ack
+		false,        // exclusive
+		false,        // no-local
+		false,        // no-wait
+		nil,          // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register consumer: %w", err)
+	}
+
+	r.consumers.Add(int32(workers))
+	r.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer r.wg.Done()
+			defer r.consumers.Add(-1)
+			for msg := range msgs {
+				r.handle(msg, handler, onDead)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Healthy implements Queue.
+func (r *rabbitMQ) Healthy() error {
+	switch {
+	case r.conn.IsClosed():
+		return errors.New("connection to RabbitMQ is closed")
+	case r.channel.IsClosed():
+		return errors.New("RabbitMQ channel is closed")
+	case r.consumers.Load() == 0:
+		return errors.New("RabbitMQ consumer stopped")
+	}
+	return nil
+}
+
+func (r *rabbitMQ) handle(msg amqp.Delivery, handler Handler, onDead DeadHandler) {
+	ctx := logging.WithCorrelationID(r.ctx, msg.CorrelationId)
+	err := handler(ctx, msg.Body)
+	if err == nil {
+		metrics.QueueAcked.Inc()
+		msg.Ack(false)
+		return
+	}
+	if r.ctx.Err() != nil {
+		// Cut short by Close, this attempt doesn't count.
+		msg.Nack(false, true)
+		return
+	}
+
+	attempt := retryCount(msg.Headers) + 1
+	target := r.retry.Name
+	expiration := strconv.FormatInt(retryDelay(r.cfg).Milliseconds(), 10)
+	outcome := failure(r.cfg, attempt, err)
+	isDead := outcome == dead
+	switch outcome {
+	case dead:
+		logging.From(ctx).Warn("Message moved to the dead letter queue", "message", string(msg.Body), "attempts", attempt, "err", err)
+		target, expiration = r.dead.Name, ""
+	case delay:
+		logging.From(ctx).Debug("Message is not ready yet", "message", string(msg.Body), "err", err)
+		attempt--
+	default:
+		logging.From(ctx).Info("Message will be retried", "message", string(msg.Body), "attempt", attempt, "err", err)
+	}
+
+	pubCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	perr := r.channel.PublishWithContext(
+		pubCtx,
+		"",     // exchange
+		target, // routing key
+		false,  // mandatory
+		false,  // immediate
+		amqp.Publishing{
+			DeliveryMode:  amqp.Persistent,
+			ContentType:   msg.ContentType,
+			CorrelationId: msg.CorrelationId,
+			Headers:       amqp.Table{retryHeader: int32(attempt)},
+			Expiration:    expiration,
+			Body:          msg.Body,
+		},
+	)
+	if perr != nil {
+		// Could not hand the message over, let the broker redeliver it.
+		logging.From(ctx).Error("Failed to republish message", "message", string(msg.Body), "err", perr)
+		msg.Nack(false, true)
+		return
+	}
+	msg.Ack(false)
+	if isDead && onDead != nil {
+		onDead(ctx, msg.Body, err)
+	}
+}
+
+func retryCount(headers amqp.Table) int {
+	switch v := headers[retryHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+func (r *rabbitMQ) Close(ctx context.Context) error {
+	if err := r.channel.Cancel(consumerTag, false); err != nil {
+		slog.Warn("Failed to stop consuming", "err", err)
+	}
+	drain(ctx, &r.wg, r.cancel)
+
+	if err := r.channel.Close(); err != nil {
+		return fmt.Errorf("failed to close channel: %w", err)
+	}
+	if err := r.conn.Close(); err != nil {
+		return fmt.Errorf("failed to close connection: %w", err)
+	}
+	return nil
+}
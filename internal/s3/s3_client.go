@@ -1,7 +1,10 @@
 package s3
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
@@ -13,6 +16,9 @@ type (
 	s3 struct {
 		s3  *minio.Client
 		cfg *config.Config
+
+		healthOnce sync.Once
+		healthErr  error
 	}
 
 	S3 interface {
@@ -39,16 +45,27 @@ func New() (S3, error) {
 	return &s3{s3: minioClient, cfg: cfg}, nil
 }
 
+// CheckAlive reports whether the S3 server answers. The first call starts
+// the background health check of the client, later ones read its result.
 func (s *s3) CheckAlive() error {
-	timeout := time.Duration(1 * time.Second)
-	_, err := s.s3.HealthCheck(timeout)
-	return err
+	s.healthOnce.Do(func() {
+		timeout := time.Duration(1 * time.Second)
+		_, s.healthErr = s.s3.HealthCheck(timeout)
+	})
+	if s.healthErr != nil {
+		return s.healthErr
+	}
+	if s.s3.IsOffline() {
+		return fmt.Errorf("s3 server %s is offline", s.cfg.BUCKET_SERVER)
+	}
+	return nil
 }
 
 func (s *s3) Reconstructor() {
 	S3, err := New()
 	if err != nil {
-		log.Fatalln(err)
+		slog.Error("Failed to recreate S3 client", "err", err)
+		os.Exit(1)
 	}
 	s.s3 = S3.GetClient().s3
 }
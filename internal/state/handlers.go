@@ -0,0 +1,96 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/telegram"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// BotHandler answers "/status <event id>" with the lifecycle of the event,
+// in the chats guard allows.
+func BotHandler(tracker Tracker, guard telegram.Guard) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if update.Message == nil || !guard.Allow(update) {
+			return
+		}
+
+		var text string
+		_, eventID, _ := strings.Cut(strings.TrimSpace(update.Message.Text), " ")
+		eventID = strings.TrimSpace(eventID)
+		if eventID == "" {
+			text = "Usage: /status [instance/]<event id>"
+		} else if rec, err := tracker.Get(ctx, eventID); err != nil {
+			text = "Error: " + err.Error()
+		} else if rec == nil {
+			text = "Unknown event " + eventID
+		} else {
+			text = rec.String()
+		}
+
+		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          update.Message.Chat.ID,
+			MessageThreadID: update.Message.MessageThreadID,
+			Text:            text,
+		})
+		if err != nil {
+			slog.Error("Failed to answer /status", "err", err)
+		}
+	}
+}
+
+// HTTPHandler serves the record of the event named by the {id...} path
+// value, "<event id>" or "<instance>/<event id>", as JSON.
+func HTTPHandler(tracker Tracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, err := tracker.Get(r.Context(), r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rec == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rec)
+	})
+}
+
+// String renders the record for humans, oldest step first.
+func (r Record) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Event %s: %s\n", r.EventID, r.State)
+	if r.Camera != "" {
+		fmt.Fprintf(&sb, "Camera: %s, Label: %s\n", r.Camera, r.Label)
+	}
+
+	steps := make([]State, 0, len(r.History))
+	for s := range r.History {
+		steps = append(steps, s)
+	}
+	sort.Slice(steps, func(i, j int) bool { return r.History[steps[i]].Before(r.History[steps[j]]) })
+	for _, s := range steps {
+		fmt.Fprintf(&sb, "  %s  %s\n", r.History[s].Format(time.DateTime), s)
+	}
+
+	if r.S3Key != "" {
+		fmt.Fprintf(&sb, "S3: %s\n", r.S3Key)
+	}
+	if r.MessageID != 0 {
+		fmt.Fprintf(&sb, "Message: %d\n", r.MessageID)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(&sb, "Error: %s\n", r.Error)
+	}
+	return sb.String()
+}
@@ -0,0 +1,179 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+const (
+	eventPrefix = "frigate:event:"
+	pendingKey  = "frigate:events:pending"
+)
+
+type redisTracker struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// NewRedis returns a Tracker keeping each event in the hash
+// frigate:event:<id> for ttl, and the IDs of unfinished events in the sorted
+// set frigate:events:pending.
+func NewRedis(rdb *redis.Client, ttl time.Duration) Tracker {
+	return &redisTracker{rdb: rdb, ttl: ttl}
+}
+
+// Transition implements Tracker.
+func (r *redisTracker) Transition(ctx context.Context, eventID string, next State, info Info) error {
+	key := eventPrefix + eventID
+	txf := func(tx *redis.Tx) error {
+		cur, err := tx.HGet(ctx, key, "state").Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if !State(cur).CanTransition(next) {
+			return &ErrTransition{EventID: eventID, From: State(cur), To: next}
+		}
+
+		now := time.Now()
+		fields := infoFields(info)
+		fields["state"] = string(next)
+		fields["updated_at"] = now.Unix()
+		fields[string(next)+"_at"] = now.Unix()
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, fields)
+			pipe.Expire(ctx, key, r.ttl)
+			if next.Terminal() {
+				pipe.ZRem(ctx, pendingKey, eventID)
+			} else {
+				pipe.ZAdd(ctx, pendingKey, redis.Z{Score: float64(now.Unix()), Member: eventID})
+			}
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		err := r.rdb.Watch(ctx, txf, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move event %s to %s: %w", eventID, next, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to move event %s to %s: %w", eventID, next, redis.TxFailedErr)
+}
+
+// RecordError implements Tracker.
+func (r *redisTracker) RecordError(ctx context.Context, eventID string, err error) error {
+	return r.Annotate(ctx, eventID, Info{Err: err})
+}
+
+// Annotate implements Tracker.
+func (r *redisTracker) Annotate(ctx context.Context, eventID string, info Info) error {
+	key := eventPrefix + eventID
+	fields := infoFields(info)
+	fields["updated_at"] = time.Now().Unix()
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, fields)
+		pipe.Expire(ctx, key, r.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to annotate event %s: %w", eventID, err)
+	}
+	return nil
+}
+
+// Get implements Tracker.
+func (r *redisTracker) Get(ctx context.Context, eventID string) (*Record, error) {
+	fields, err := r.rdb.HGetAll(ctx, eventPrefix+eventID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event %s: %w", eventID, err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	rec := &Record{
+		EventID: eventID,
+		State:   State(fields["state"]),
+		Camera:  fields["camera"],
+		Label:   fields["label"],
+		S3Key:   fields["s3_key"],
+		Error:   fields["error"],
+		History: make(map[State]time.Time),
+	}
+	rec.MessageID, _ = strconv.Atoi(fields["message_id"])
+	rec.PreviewMessageID, _ = strconv.Atoi(fields["preview_message_id"])
+	rec.UpdatedAt = unix(fields["updated_at"])
+	for k, v := range fields {
+		if s, ok := strings.CutSuffix(k, "_at"); ok && k != "updated_at" {
+			rec.History[State(s)] = unix(v)
+		}
+	}
+	return rec, nil
+}
+
+// Pending implements Tracker.
+func (r *redisTracker) Pending(ctx context.Context) ([]Record, error) {
+	ids, err := r.rdb.ZRange(ctx, pendingKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending events: %w", err)
+	}
+
+	var records []Record
+	for _, id := range ids {
+		rec, err := r.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil || rec.State.Terminal() {
+			// The hash expired or was finished by another replica.
+			r.rdb.ZRem(ctx, pendingKey, id)
+			continue
+		}
+		records = append(records, *rec)
+	}
+	return records, nil
+}
+
+// infoFields returns the hash fields set by info.
+func infoFields(info Info) map[string]any {
+	fields := make(map[string]any)
+	if info.Camera != "" {
+		fields["camera"] = info.Camera
+	}
+	if info.Label != "" {
+		fields["label"] = info.Label
+	}
+	if info.MessageID != 0 {
+		fields["message_id"] = info.MessageID
+	}
+	if info.PreviewMessageID != 0 {
+		fields["preview_message_id"] = info.PreviewMessageID
+	}
+	if info.S3Key != "" {
+		fields["s3_key"] = info.S3Key
+	}
+	if info.Err != nil {
+		fields["error"] = info.Err.Error()
+	}
+	return fields
+}
+
+func unix(v string) time.Time {
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
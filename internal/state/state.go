@@ -0,0 +1,122 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// State is a step of the pipeline an event went through.
+type State string
+
+const (
+	Detected       State = "detected"
+	SnapshotSent   State = "snapshot_sent"
+	Queued         State = "queued"
+	ClipDownloaded State = "clip_downloaded"
+	Uploaded       State = "uploaded"
+	Delivered      State = "delivered"
+	Failed         State = "failed"
+)
+
+// transitions lists the states reachable from each state. A clip worker retry
+// starts over from the download, hence the edges back to ClipDownloaded.
+var transitions = map[State][]State{
+	"":             {Detected},
+	Detected:       {SnapshotSent, Queued, Failed},
+	SnapshotSent:   {Queued, Failed},
+	Queued:         {ClipDownloaded, Delivered, Failed},
+	ClipDownloaded: {ClipDownloaded, Uploaded, Delivered, Failed},
+	Uploaded:       {ClipDownloaded, Delivered, Failed},
+	Delivered:      {},
+	Failed:         {},
+}
+
+// Terminal reports whether nothing is left to do for an event in s.
+func (s State) Terminal() bool {
+	return s == Delivered || s == Failed
+}
+
+// CanTransition reports whether an event in s may move to next.
+func (s State) CanTransition(next State) bool {
+	for _, t := range transitions[s] {
+		if t == next {
+			return true
+		}
+	}
+	return false
+}
+
+type (
+	// Info carries the details recorded along with a transition. Zero
+	// values are left untouched.
+	Info struct {
+		Camera           string
+		Label            string
+		MessageID        int
+		PreviewMessageID int
+		S3Key            string
+		Err              error
+	}
+
+	// Record is the stored lifecycle of an event.
+	Record struct {
+		EventID          string              `json:"event_id"`
+		State            State               `json:"state"`
+		Camera           string              `json:"camera,omitempty"`
+		Label            string              `json:"label,omitempty"`
+		MessageID        int                 `json:"message_id,omitempty"`
+		PreviewMessageID int                 `json:"preview_message_id,omitempty"`
+		S3Key            string              `json:"s3_key,omitempty"`
+		Error            string              `json:"error,omitempty"`
+		UpdatedAt        time.Time           `json:"updated_at"`
+		History          map[State]time.Time `json:"history"`
+	}
+
+	// Tracker persists the lifecycle of every event.
+	Tracker interface {
+		// Transition moves eventID to next, refusing moves the state
+		// machine doesn't allow.
+		Transition(ctx context.Context, eventID string, next State, info Info) error
+		// RecordError stores the reason of a failure that will be retried
+		// without changing the state.
+		RecordError(ctx context.Context, eventID string, err error) error
+		// Annotate stores info without changing the state.
+		Annotate(ctx context.Context, eventID string, info Info) error
+		// Get returns the record of eventID, or nil if it is unknown.
+		Get(ctx context.Context, eventID string) (*Record, error)
+		// Pending returns the events that haven't reached a terminal state.
+		Pending(ctx context.Context) ([]Record, error)
+	}
+)
+
+// New returns a Redis backed Tracker, or one that records nothing when
+// cfg.EventStateEnabled is false.
+func New(rdb *redis.Client) Tracker {
+	cfg := config.New()
+	if !cfg.EventStateEnabled {
+		return noop{}
+	}
+	return NewRedis(rdb, time.Duration(cfg.EventStateTTL)*time.Second)
+}
+
+// ErrTransition is returned when a transition isn't allowed.
+type ErrTransition struct {
+	EventID  string
+	From, To State
+}
+
+func (e *ErrTransition) Error() string {
+	return fmt.Sprintf("event %s can't move from %q to %q", e.EventID, e.From, e.To)
+}
+
+type noop struct{}
+
+func (noop) Transition(context.Context, string, State, Info) error { return nil }
+func (noop) RecordError(context.Context, string, error) error      { return nil }
+func (noop) Annotate(context.Context, string, Info) error          { return nil }
+func (noop) Get(context.Context, string) (*Record, error)          { return nil, nil }
+func (noop) Pending(context.Context) ([]Record, error)             { return nil, nil }
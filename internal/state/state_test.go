@@ -0,0 +1,148 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifecycles(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []State
+	}{
+		{"snapshot then clip", []State{Detected, SnapshotSent, Queued, ClipDownloaded, Delivered}},
+		{"uploaded to the bucket", []State{Detected, SnapshotSent, Queued, ClipDownloaded, Uploaded, Delivered}},
+		{"no snapshot", []State{Detected, Queued, ClipDownloaded, Delivered}},
+		{"clip unavailable", []State{Detected, SnapshotSent, Queued, Delivered}},
+		{"retried download", []State{Detected, Queued, ClipDownloaded, ClipDownloaded, Delivered}},
+		{"retried after upload", []State{Detected, Queued, ClipDownloaded, Uploaded, ClipDownloaded, Uploaded, Delivered}},
+		{"failed", []State{Detected, SnapshotSent, Queued, ClipDownloaded, Failed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cur State
+			for _, next := range tt.steps {
+				if !cur.CanTransition(next) {
+					t.Fatalf("%q can't move to %q", cur, next)
+				}
+				cur = next
+			}
+			if !cur.Terminal() {
+				t.Errorf("ends in %q, which isn't terminal", cur)
+			}
+		})
+	}
+}
+
+func TestRefusedTransitions(t *testing.T) {
+	tests := []struct{ from, to State }{
+		{"", Queued},
+		{"", Delivered},
+		{Detected, Detected},
+		{Detected, ClipDownloaded},
+		{Queued, SnapshotSent},
+		{SnapshotSent, Delivered},
+		{Delivered, ClipDownloaded},
+		{Delivered, Failed},
+		{Failed, Detected},
+		{Failed, Queued},
+	}
+	for _, tt := range tests {
+		if tt.from.CanTransition(tt.to) {
+			t.Errorf("%q may move to %q", tt.from, tt.to)
+		}
+	}
+}
+
+// TestReachesTerminal checks that no state is a dead end.
+func TestReachesTerminal(t *testing.T) {
+	for s := range transitions {
+		seen := map[State]bool{s: true}
+		next := []State{s}
+		terminal := false
+		for len(next) > 0 && !terminal {
+			cur := next[0]
+			next = next[1:]
+			terminal = cur.Terminal()
+			for _, n := range transitions[cur] {
+				if !seen[n] {
+					seen[n] = true
+					next = append(next, n)
+				}
+			}
+		}
+		if !terminal {
+			t.Errorf("%q never reaches a terminal state", s)
+		}
+		if s.Terminal() && len(transitions[s]) > 0 {
+			t.Errorf("terminal %q has transitions", s)
+		}
+	}
+}
+
+type fakeTracker struct {
+	noop
+	records map[string]*Record
+}
+
+func (f fakeTracker) Get(_ context.Context, eventID string) (*Record, error) {
+	return f.records[eventID], nil
+}
+
+func TestHTTPHandler(t *testing.T) {
+	at := time.Date(2024, 8, 30, 6, 40, 0, 0, time.UTC)
+	tracker := fakeTracker{records: map[string]*Record{
+		"home/1725000000.6-r4nd0m": {EventID: "home/1725000000.6-r4nd0m", State: Queued, History: map[State]time.Time{Detected: at, Queued: at.Add(time.Minute)}},
+	}}
+	mux := http.NewServeMux()
+	mux.Handle("GET /events/{id...}", HTTPHandler(tracker))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events/home/1725000000.6-r4nd0m", nil))
+	var got Record
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %v", rec.Code, err)
+	}
+	if got.State != Queued || !got.History[Queued].Equal(at.Add(time.Minute)) {
+		t.Errorf("got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown event: status %d", rec.Code)
+	}
+}
+
+func TestRecordString(t *testing.T) {
+	at := time.Date(2024, 8, 30, 6, 40, 0, 0, time.UTC)
+	r := Record{
+		EventID: "1725000000.6-r4nd0m",
+		State:   Delivered,
+		Camera:  "Rua",
+		Label:   "car",
+		History: map[State]time.Time{
+			Delivered: at.Add(2 * time.Minute),
+			Detected:  at,
+			Queued:    at.Add(time.Minute),
+		},
+		MessageID: 42,
+	}
+	want := "Event 1725000000.6-r4nd0m: delivered\n" +
+		"Camera: Rua, Label: car\n" +
+		"  2024-08-30 06:40:00  detected\n" +
+		"  2024-08-30 06:41:00  queued\n" +
+		"  2024-08-30 06:42:00  delivered\n" +
+		"Message: 42\n"
+	if got := r.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if strings.Contains(r.String(), "S3:") {
+		t.Error("empty S3 key shown")
+	}
+}
@@ -0,0 +1,62 @@
+package telegram
+
+import (
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/go-telegram/bot/models"
+)
+
+type (
+	guard struct {
+		chats map[int64]bool
+		users map[int64]bool
+	}
+
+	// Guard decides which updates the bot acts on, so that recordings and
+	// events are only shown to the chats the bot posts to.
+	Guard interface {
+		// Allow reports whether update comes from an allowed chat and, for
+		// button presses, from an allowed user.
+		Allow(update *models.Update) bool
+	}
+)
+
+// NewGuard allows TELEGRAM_CHAT_ID, TELEGRAM_ERROR_CHAT_ID and the chat of
+// every Frigate instance. When TELEGRAM_ALLOWED_USERS is set only those users
+// may press the buttons.
+func NewGuard() Guard {
+	cfg := config.New()
+	g := &guard{chats: map[int64]bool{
+		cfg.TelegramChatID:      true,
+		cfg.TelegramErrorChatID: true,
+	}}
+	for _, inst := range cfg.FrigateInstances {
+		g.chats[inst.ChatID] = true
+	}
+	delete(g.chats, 0)
+	if len(cfg.TelegramAllowedUsers) > 0 {
+		g.users = make(map[int64]bool, len(cfg.TelegramAllowedUsers))
+		for _, id := range cfg.TelegramAllowedUsers {
+			g.users[id] = true
+		}
+	}
+	return g
+}
+
+func (g *guard) Allow(update *models.Update) bool {
+	switch {
+	case update.Message != nil:
+		return g.chats[update.Message.Chat.ID]
+	case update.CallbackQuery != nil:
+		if g.users != nil && !g.users[update.CallbackQuery.From.ID] {
+			return false
+		}
+		msg := update.CallbackQuery.Message
+		switch {
+		case msg.Message != nil:
+			return g.chats[msg.Message.Chat.ID]
+		case msg.InaccessibleMessage != nil:
+			return g.chats[msg.InaccessibleMessage.Chat.ID]
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// InFlight keeps count of the bot handlers running, like /export writing
+// recordings to disk, so that shutdown can wait for them.
+type InFlight struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Middleware counts the handlers it wraps. Updates arriving after Wait was
+// called are dropped.
+func (f *InFlight) Middleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			return
+		}
+		f.wg.Add(1)
+		f.mu.Unlock()
+		defer f.wg.Done()
+
+		next(ctx, b, update)
+	}
+}
+
+// Wait waits for the running handlers, or until ctx is done.
+func (f *InFlight) Wait(ctx context.Context) error {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,328 @@
+// Package telegram paces the requests made to the Bot API under Telegram's
+// rate limits, retries the ones refused with 429 Too Many Requests or
+// failing transiently, and receives the updates over a webhook.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	"github.com/go-telegram/bot"
+)
+
+// PollTimeout is how long a getUpdates long poll waits for updates.
+const PollTimeout = time.Minute
+
+type (
+	// bucket is a token bucket handing out reservations, so that requests
+	// waiting for it are served in order.
+	bucket struct {
+		rate   float64 // tokens per second
+		burst  float64
+		tokens float64
+		last   time.Time
+	}
+
+	limiter struct {
+		client  bot.HttpClient
+		retries int
+		timeout time.Duration
+		speed   float64 // bytes per second
+
+		chat      float64
+		group     float64
+		groupSize float64
+
+		mu     sync.Mutex
+		all    *bucket
+		chats  map[string]*bucket
+		groups map[string]*bucket
+		// held holds back the requests to a chat ("" for all of them)
+		// after a 429, including the ones that already had their turn.
+		held    map[string]time.Time
+		backoff time.Duration
+	}
+)
+
+// NewClient wraps client so that requests wait their turn: globally at
+// TELEGRAM_RATE_GLOBAL per second, per chat at TELEGRAM_RATE_CHAT per
+// second, and per group or channel at TELEGRAM_RATE_GROUP per minute. A
+// request refused with 429 is retried after the retry_after Telegram asks
+// for, network errors and 5xx after a backoff, up to TELEGRAM_RETRIES times.
+// Each attempt has TELEGRAM_TIMEOUT, plus the time its body takes to upload
+// at TELEGRAM_UPLOAD_SPEED, so that large clips aren't cut short.
+func NewClient(client bot.HttpClient) bot.HttpClient {
+	cfg := config.New()
+	return &limiter{
+		client:    client,
+		retries:   cfg.TelegramRetries,
+		timeout:   time.Duration(cfg.TelegramTimeout) * time.Second,
+		speed:     float64(cfg.TelegramUploadSpeed) * 1024,
+		chat:      cfg.TelegramRateChat,
+		group:     cfg.TelegramRateGroup / 60,
+		groupSize: cfg.TelegramRateGroup,
+		all:       newBucket(cfg.TelegramRateGlobal, cfg.TelegramRateGlobal),
+		chats:     make(map[string]*bucket),
+		groups:    make(map[string]*bucket),
+		held:      make(map[string]time.Time),
+		backoff:   time.Second,
+	}
+}
+
+func newBucket(rate, burst float64) *bucket {
+	return &bucket{rate: rate, burst: max(burst, 1), tokens: max(burst, 1), last: time.Now()}
+}
+
+// refill adds the tokens earned since the last call.
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// reserve takes a token and returns when it may be used.
+func (b *bucket) reserve(now time.Time) time.Time {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 || b.rate <= 0 {
+		return now
+	}
+	return now.Add(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+}
+
+// pause keeps the bucket empty for d.
+func (b *bucket) pause(now time.Time, d time.Duration) {
+	b.refill(now)
+	b.tokens = min(b.tokens, -d.Seconds()*b.rate)
+}
+
+func (l *limiter) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	if method == "getUpdates" {
+		return l.do(req, PollTimeout+l.timeout)
+	}
+	chat := chatID(req)
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		if err := l.wait(req, chat); err != nil {
+			return nil, err
+		}
+		metrics.TelegramQueueWait.Observe(time.Since(start).Seconds())
+
+		try := req
+		if attempt > 0 {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			try = req.Clone(req.Context())
+			try.Body = body
+		}
+		resp, err := l.do(try, l.deadline(req))
+		retryAfter, retry := l.retryable(resp, err, attempt)
+		if !retry || attempt >= l.retries || req.GetBody == nil || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		metrics.TelegramRetries.WithLabelValues(method).Inc()
+		slog.Warn("Retrying Telegram request", "method", method, "chat_id", chat, "attempt", attempt+1, "retry_in", retryAfter, "err", err)
+		l.pause(chat, retryAfter)
+	}
+}
+
+// deadline is how long one attempt at req may take.
+func (l *limiter) deadline(req *http.Request) time.Duration {
+	d := l.timeout
+	if req.ContentLength > 0 && l.speed > 0 {
+		d += time.Duration(float64(req.ContentLength) / l.speed * float64(time.Second))
+	}
+	return d
+}
+
+// do sends req within timeout, which also covers reading the response.
+func (l *limiter) do(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := l.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the context of a request once its response is read.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// wait blocks until req may be sent to chat, or its context is done.
+func (l *limiter) wait(req *http.Request, chat string) error {
+	for {
+		for _, reserve := range []func(time.Time) time.Time{
+			func(now time.Time) time.Time { return l.reserveChat(now, chat) },
+			l.all.reserve,
+		} {
+			l.mu.Lock()
+			at := reserve(time.Now())
+			l.mu.Unlock()
+			if err := sleep(req, at); err != nil {
+				return err
+			}
+		}
+
+		// A 429 came in while waiting: queue again behind the pause
+		// rather than all going at once when it ends.
+		l.mu.Lock()
+		at := l.held[chat]
+		if all := l.held[""]; all.After(at) {
+			at = all
+		}
+		l.mu.Unlock()
+		if !at.After(time.Now()) {
+			return nil
+		}
+		if err := sleep(req, at); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits until at, or until the context of req is done.
+func sleep(req *http.Request, at time.Time) error {
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserveChat takes a turn in the buckets of chat. Must hold l.mu.
+func (l *limiter) reserveChat(now time.Time, chat string) time.Time {
+	if chat == "" {
+		return now
+	}
+	b, ok := l.chats[chat]
+	if !ok {
+		b = newBucket(l.chat, 1)
+		l.chats[chat] = b
+	}
+	at := b.reserve(now)
+
+	// Group and channel IDs are negative.
+	if strings.HasPrefix(chat, "-") {
+		g, ok := l.groups[chat]
+		if !ok {
+			g = newBucket(l.group, l.groupSize)
+			l.groups[chat] = g
+		}
+		if gAt := g.reserve(now); gAt.After(at) {
+			at = gAt
+		}
+	}
+	return at
+}
+
+// pause holds back the requests to chat, or all of them when the request
+// had no chat, for d.
+func (l *limiter) pause(chat string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if until := now.Add(d); until.After(l.held[chat]) {
+		l.held[chat] = until
+	}
+	if b, ok := l.chats[chat]; ok {
+		b.pause(now, d)
+		return
+	}
+	l.all.pause(now, d)
+}
+
+// retryable tells whether a request that got resp and err is worth another
+// attempt, and after how long.
+func (l *limiter) retryable(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	backoff := l.backoff << attempt
+	switch {
+	case err != nil:
+		return backoff, true
+	case resp.StatusCode == http.StatusTooManyRequests:
+		body, rerr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if rerr != nil {
+			return backoff, true
+		}
+		var r struct {
+			Parameters struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		if json.Unmarshal(body, &r) == nil && r.Parameters.RetryAfter > 0 {
+			return time.Duration(r.Parameters.RetryAfter) * time.Second, true
+		}
+		return backoff, true
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return backoff, true
+	}
+	return 0, false
+}
+
+// chatID returns the chat_id field of the multipart form sent by req, or ""
+// when it has none.
+func chatID(req *http.Request) string {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" || req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	form := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() == "chat_id" {
+			value, err := io.ReadAll(io.LimitReader(part, 64))
+			if err != nil {
+				return ""
+			}
+			return strings.TrimSpace(string(value))
+		}
+	}
+}
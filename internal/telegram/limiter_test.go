@@ -0,0 +1,161 @@
+package telegram
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := newBucket(2, 2)
+	b.last = now
+
+	// The burst goes at once, then one token every half second.
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if got := b.reserve(now).Sub(now); got != want {
+			t.Errorf("reservation %d: in %s, want %s", i+1, got, want)
+		}
+	}
+
+	b = newBucket(2, 2)
+	b.last = now
+	b.pause(now, 3*time.Second)
+	if got, want := b.reserve(now).Sub(now), 3500*time.Millisecond; got != want {
+		t.Errorf("after a pause: in %s, want %s", got, want)
+	}
+	if got := b.reserve(now.Add(time.Hour)).Sub(now.Add(time.Hour)); got != 0 {
+		t.Errorf("after refilling: in %s, want 0", got)
+	}
+}
+
+func response(status int, body string) *http.Response {
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestRetryable(t *testing.T) {
+	l := &limiter{backoff: time.Second}
+	tests := []struct {
+		name    string
+		resp    *http.Response
+		err     error
+		attempt int
+		after   time.Duration
+		retry   bool
+	}{
+		{"ok", response(http.StatusOK, `{"ok":true}`), nil, 0, 0, false},
+		{"bad request", response(http.StatusBadRequest, `{"ok":false}`), nil, 0, 0, false},
+		{"forbidden", response(http.StatusForbidden, `{"ok":false}`), nil, 0, 0, false},
+		{"retry_after", response(http.StatusTooManyRequests, `{"ok":false,"parameters":{"retry_after":7}}`), nil, 2, 7 * time.Second, true},
+		{"429 without retry_after", response(http.StatusTooManyRequests, `{"ok":false}`), nil, 1, 2 * time.Second, true},
+		{"server error", response(http.StatusBadGateway, ""), nil, 2, 4 * time.Second, true},
+		{"network error", nil, errors.New("connection reset"), 0, time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, retry := l.retryable(tt.resp, tt.err, tt.attempt)
+			if after != tt.after || retry != tt.retry {
+				t.Errorf("got %s %v, want %s %v", after, retry, tt.after, tt.retry)
+			}
+		})
+	}
+
+	// The body read for retry_after is still there for the caller.
+	resp := response(http.StatusTooManyRequests, `{"parameters":{"retry_after":1}}`)
+	l.retryable(resp, nil, 0)
+	if body, _ := io.ReadAll(resp.Body); !bytes.Contains(body, []byte("retry_after")) {
+		t.Errorf("body after retryable: %q", body)
+	}
+}
+
+func multipartRequest(t *testing.T, fields map[string]string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	w.Close()
+	req, err := http.NewRequest(http.MethodPost, "https://api.telegram.org/bot1:x/sendVideo", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestChatID(t *testing.T) {
+	if got := chatID(multipartRequest(t, map[string]string{"chat_id": "-1001234", "caption": "x"})); got != "-1001234" {
+		t.Errorf("group: got %q", got)
+	}
+	if got := chatID(multipartRequest(t, map[string]string{"offset": "5"})); got != "" {
+		t.Errorf("no chat_id: got %q", got)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/bot1:x/getMe", nil)
+	if got := chatID(req); got != "" {
+		t.Errorf("no body: got %q", got)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	l := &limiter{timeout: time.Minute, speed: 1024 * 1024}
+	req := multipartRequest(t, map[string]string{"chat_id": "1"})
+	if got := l.deadline(req); got <= time.Minute || got > time.Minute+time.Second {
+		t.Errorf("small body: %s", got)
+	}
+	req.ContentLength = 50 * 1024 * 1024
+	if got, want := l.deadline(req), time.Minute+50*time.Second; got != want {
+		t.Errorf("50 MB: %s, want %s", got, want)
+	}
+}
+
+type fakeClient struct {
+	responses []*http.Response
+	calls     int
+}
+
+func (c *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	if _, deadline := req.Context().Deadline(); !deadline {
+		return nil, errors.New("request without a deadline")
+	}
+	resp := c.responses[min(c.calls, len(c.responses)-1)]
+	c.calls++
+	return resp, nil
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []*http.Response
+		calls     int
+		status    int
+	}{
+		{"success", []*http.Response{response(http.StatusOK, "")}, 1, http.StatusOK},
+		{"transient", []*http.Response{response(http.StatusBadGateway, ""), response(http.StatusOK, "")}, 2, http.StatusOK},
+		{"gives up", []*http.Response{response(http.StatusBadGateway, "")}, 3, http.StatusBadGateway},
+		{"permanent", []*http.Response{response(http.StatusBadRequest, "")}, 1, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TELEGRAM_RETRIES", "2")
+			t.Setenv("TELEGRAM_RATE_CHAT", "1000")
+			client := &fakeClient{responses: tt.responses}
+			l := NewClient(client).(*limiter)
+			l.backoff = time.Millisecond
+
+			resp, err := l.Do(multipartRequest(t, map[string]string{"chat_id": "1"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if client.calls != tt.calls || resp.StatusCode != tt.status {
+				t.Errorf("%d calls ending in %d, want %d ending in %d", client.calls, resp.StatusCode, tt.calls, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package telegram
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/go-telegram/bot"
+)
+
+// maxUpdate bounds the body of a webhook request, updates are a few KB.
+const maxUpdate = 1 << 20
+
+type (
+	webhook struct {
+		bot    *bot.Bot
+		url    string
+		path   string
+		addr   string
+		secret string
+		cert   string
+		key    string
+	}
+
+	// Webhook receives the updates of the bot from Telegram over HTTP(S),
+	// instead of long polling getUpdates.
+	Webhook interface {
+		// Run serves the webhook and handles its updates until ctx is done.
+		Run(ctx context.Context) error
+		// Register points Telegram at the webhook.
+		Register(ctx context.Context) error
+		// Unregister removes the webhook. Telegram keeps the updates until
+		// the next Register.
+		Unregister(ctx context.Context) error
+	}
+)
+
+// NewWebhook returns the webhook of b at TELEGRAM_WEBHOOK_URL, listening on
+// TELEGRAM_WEBHOOK_ADDR. Requests must carry TELEGRAM_WEBHOOK_SECRET, or a
+// secret derived from the bot token, so that every replica agrees on it.
+func NewWebhook(b *bot.Bot) (Webhook, error) {
+	cfg := config.New()
+	u, err := url.Parse(cfg.TelegramWebhookURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("TELEGRAM_WEBHOOK_URL must be an https URL, got %q", cfg.TelegramWebhookURL)
+	}
+	if (cfg.TelegramWebhookCert == "") != (cfg.TelegramWebhookKey == "") {
+		return nil, errors.New("TELEGRAM_WEBHOOK_CERT and TELEGRAM_WEBHOOK_KEY go together")
+	}
+
+	secret := cfg.TelegramWebhookSecret
+	if secret == "" {
+		sum := sha256.Sum256([]byte("webhook:" + cfg.TelegramBotToken))
+		secret = hex.EncodeToString(sum[:])
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return &webhook{
+		bot:    b,
+		url:    u.String(),
+		path:   path,
+		addr:   cfg.TelegramWebhookAddr,
+		secret: secret,
+		cert:   cfg.TelegramWebhookCert,
+		key:    cfg.TelegramWebhookKey,
+	}, nil
+}
+
+func (w *webhook) Run(ctx context.Context) error {
+	go w.bot.StartWebhook(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("POST "+w.path, w.handler(ctx))
+	srv := &http.Server{Addr: w.addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to stop webhook server", "err", err)
+		}
+	}()
+
+	slog.Info("Serving Telegram webhook", "addr", w.addr, "path", w.path, "tls", w.cert != "")
+	var err error
+	if w.cert != "" {
+		err = srv.ListenAndServeTLS(w.cert, w.key)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// handler passes the updates carrying the secret to the bot. Once ctx is
+// done the bot no longer handles them, so they are refused for Telegram to
+// send again later rather than lost.
+func (w *webhook) handler(ctx context.Context) http.Handler {
+	next := w.bot.WebhookHandler()
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		token := req.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(w.secret)) != 1 {
+			slog.Warn("Refused webhook request with a wrong secret token", "remote", req.RemoteAddr)
+			http.Error(rw, "forbidden", http.StatusForbidden)
+			return
+		}
+		if ctx.Err() != nil {
+			http.Error(rw, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		req.Body = http.MaxBytesReader(rw, req.Body, maxUpdate)
+		next(rw, req)
+	})
+}
+
+func (w *webhook) Register(ctx context.Context) error {
+	_, err := w.bot.SetWebhook(ctx, &bot.SetWebhookParams{URL: w.url, SecretToken: w.secret})
+	if err != nil {
+		return fmt.Errorf("set webhook: %w", err)
+	}
+	slog.Info("Registered Telegram webhook", "url", w.url)
+	return nil
+}
+
+func (w *webhook) Unregister(ctx context.Context) error {
+	if _, err := w.bot.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+	slog.Info("Removed Telegram webhook")
+	return nil
+}
@@ -0,0 +1,112 @@
+package telegram
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestNewWebhookConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		ok   bool
+	}{
+		{"https", map[string]string{"TELEGRAM_WEBHOOK_URL": "https://bot.example.com/telegram"}, true},
+		{"plain http", map[string]string{"TELEGRAM_WEBHOOK_URL": "http://bot.example.com/telegram"}, false},
+		{"no host", map[string]string{"TELEGRAM_WEBHOOK_URL": "https:///telegram"}, false},
+		{"cert without key", map[string]string{"TELEGRAM_WEBHOOK_URL": "https://bot.example.com", "TELEGRAM_WEBHOOK_CERT": "cert.pem"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if _, err := NewWebhook(nil); (err == nil) != tt.ok {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestWebhookSecret(t *testing.T) {
+	t.Setenv("TELEGRAM_WEBHOOK_URL", "https://bot.example.com")
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:abc")
+	w, err := NewWebhook(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("webhook:123:abc"))
+	if got := w.(*webhook).secret; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("derived secret %q", got)
+	}
+	if got := w.(*webhook).path; got != "/" {
+		t.Errorf("path %q, want /", got)
+	}
+
+	t.Setenv("TELEGRAM_WEBHOOK_SECRET", "s3cret")
+	if w, _ := NewWebhook(nil); w.(*webhook).secret != "s3cret" {
+		t.Errorf("configured secret not used: %q", w.(*webhook).secret)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	updates := make(chan int64, 1)
+	b, err := bot.New("123:abc", bot.WithSkipGetMe(), bot.WithDefaultHandler(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		updates <- update.ID
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.StartWebhook(ctx)
+
+	w := &webhook{bot: b, secret: "s3cret"}
+	handler := w.handler(ctx)
+	post := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id": 42}`))
+		if token != "" {
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, token := range []string{"", "wrong", "s3cret0"} {
+		if code := post(token); code != http.StatusForbidden {
+			t.Errorf("token %q: status %d, want 403", token, code)
+		}
+	}
+	select {
+	case id := <-updates:
+		t.Fatalf("update %d handled without the secret", id)
+	default:
+	}
+
+	if code := post("s3cret"); code != http.StatusOK {
+		t.Errorf("status %d, want 200", code)
+	}
+	select {
+	case id := <-updates:
+		if id != 42 {
+			t.Errorf("handled update %d", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("update not handled")
+	}
+
+	cancel()
+	if code := post("s3cret"); code != http.StatusServiceUnavailable {
+		t.Errorf("after shutdown: status %d, want 503", code)
+	}
+}
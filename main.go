@@ -3,64 +3,117 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/alert"
 	"github.com/geffersonFerraz/frigate-s3-telegram/internal/config"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/dedupe"
 	"github.com/geffersonFerraz/frigate-s3-telegram/internal/frigate"
-	"github.com/geffersonFerraz/frigate-s3-telegram/internal/rabbit"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/health"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/leader"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/logging"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/metrics"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/pipeline"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/queue"
 	"github.com/geffersonFerraz/frigate-s3-telegram/internal/s3"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/state"
+	"github.com/geffersonFerraz/frigate-s3-telegram/internal/telegram"
 	"github.com/go-telegram/bot"
-	"github.com/go-telegram/bot/models"
 	redis "github.com/redis/go-redis/v9"
 )
 
-const maxSize = 49 * 1024 * 1024 // 50MB
-
 func main() {
 
 	cfg := config.New()
+	logging.Setup()
 
 	// Bucket initialization
 	s3Client, err := s3.New()
 	if err != nil {
-		log.Fatalln(err)
+		fatal("Failed to create S3 client", err)
 	}
 
-	s3Client.CheckAlive()
-	if err != nil {
-		log.Fatalln(err)
+	if err := s3Client.CheckAlive(); err != nil {
+		fatal("S3 is not reachable", err)
 	}
 
-	ctx := context.Background()
+	// SIGTERM (docker stop) and Ctrl-C stop polling and drain the work in flight.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	s3Bucket, err := s3.Buckets(s3Client.GetClient(), cfg.BUCKET_NAME)
 	if err != nil {
-		log.Fatalln(err)
+		fatal("Failed to open bucket", err)
 	}
 
 	err = s3Bucket.Create(ctx)
 	if err != nil {
-		log.Fatalln(err)
+		fatal("Failed to create bucket", err)
 	}
 
-	log.Println("Bucket created successfully")
+	slog.Info("Bucket created successfully", "bucket", cfg.BUCKET_NAME)
 
 	// Prepare startup msg
 	startupMsg := "Starting frigate-telegram.\n"
-	startupMsg += "Frigate URL:  " + cfg.FrigateURL + "\n"
-	log.Println(startupMsg)
+	for _, inst := range cfg.FrigateInstances {
+		startupMsg += "Frigate URL:  " + inst.URL
+		if inst.Name != "" {
+			startupMsg += " (" + inst.Name + ")"
+		}
+		startupMsg += "\n"
+	}
+	slog.Info(startupMsg)
+
+	// Redis
+	var rdb = redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword, // no password set
+		DB:       cfg.RedisDB,       // use default DB
+		Protocol: cfg.RedisProtocol, // specify 2 for RESP 2 or 3 for RESP 3
+	})
+
+	// Event state initialization
+	tracker := state.New(rdb)
 
 	// Telegram initialization
-	opts := []bot.Option{}
+	guard := telegram.NewGuard()
+	handlers := &telegram.InFlight{}
+	opts := []bot.Option{
+		bot.WithMiddlewares(handlers.Middleware),
+		bot.WithHTTPClient(telegram.PollTimeout, telegram.NewClient(&metrics.TelegramClient{Client: &http.Client{}})),
+		bot.WithServerURL(cfg.TelegramAPIURL),
+		bot.WithMessageTextHandler("/status", bot.MatchTypePrefix, state.BotHandler(tracker, guard)),
+	}
 
 	b, err := bot.New(cfg.TelegramBotToken, opts...)
 	if err != nil {
-		log.Fatalln("Error initalizing telegram bot: " + err.Error())
+		fatal("Error initalizing telegram bot", err)
+	}
+
+	// Updates come from the webhook when there is one, long polling otherwise.
+	// Either way only the leader receives them, see below.
+	var webhook telegram.Webhook
+	if cfg.TelegramWebhookURL != "" {
+		if webhook, err = telegram.NewWebhook(b); err != nil {
+			fatal("Invalid Telegram webhook", err)
+		}
+		go func() {
+			if err := webhook.Run(ctx); err != nil {
+				fatal("Telegram webhook server stopped", err)
+			}
+		}()
+	} else {
+		// getUpdates is refused while a webhook is set.
+		if _, err := b.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+			slog.Warn("Failed to remove Telegram webhook", "err", err)
+		}
 	}
-	go b.Start(ctx)
 
 	// Send startup msg. conf.TelegramErrorChatID, startupMsg))
 	helloMsg := &bot.SendMessageParams{
@@ -68,243 +121,187 @@ func main() {
 		Text:   startupMsg,
 	}
 	b.SendMessage(ctx, helloMsg)
+	alerts := alert.New(b)
 
 	// Frigate initialization
-	frigate, err := frigate.NewFrigate()
+	instances, err := pipeline.NewInstances(cfg, rdb)
 	if err != nil {
-		log.Fatalln(err)
+		fatal("Failed to create Frigate clients", err)
 	}
 
-	evts, err := frigate.Events()
-	if err != nil {
-		log.Fatalln(err)
-	}
-	for _, x := range evts {
-		log.Println(x)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, pipeline.ActionPrefix, bot.MatchTypePrefix, pipeline.ActionHandler(instances, guard))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/export", bot.MatchTypePrefix, pipeline.ExportHandler(instances, guard, s3Client, alerts))
+
+	for _, inst := range instances {
+		evts, err := inst.Frigate.Events(ctx)
+		if err != nil {
+			slog.Warn("Frigate is not reachable yet", "frigate", inst.URL, "err", err)
+		}
+		for _, x := range evts {
+			slog.Debug("Event in progress", "event_id", x.ID, "camera", x.Camera, "label", x.Label)
+		}
 	}
 
-	// RabbitMQ Initialization
-	rabbit, err := rabbit.NewRabbitMQ()
+	// Queue Initialization
+	q, err := queue.New()
 	if err != nil {
-		log.Fatal(err)
+		fatal("Failed to open queue", err)
 	}
-	defer rabbit.Close()
-
-	go func() {
-		err = rabbit.Consume(func(msg []byte) error {
-			time.Sleep(1 * time.Second)
-			event, inProgress, err := frigate.GetEvent(string(msg))
-
-			if err != nil {
-				log.Println(err)
-				return err
-			}
-			if inProgress {
-				return fmt.Errorf("event %s is still in progress", string(msg))
-			}
-
-			var sendBucket = func(filePathClip string) {
-				file, err := os.Open(filePathClip)
-				if err != nil {
-					log.Println(err)
-				}
-				defer file.Close()
-
-				s3File, err := s3.Files(s3Client.GetClient())
-				if err != nil {
-					log.Println(err)
-				}
 
-				s3File.SetFile(ctx, file)
-				s3File.SetBucket(ctx, cfg.BUCKET_NAME)
-				timeHumanReadable := time.Unix(int64(event.StartTime), 0).Format("2006-01-02 15:04:05")
-				s3File.SetDestinatoin(ctx, event.Camera+"/"+timeHumanReadable+"-"+event.Label+".mp4")
-				err = s3File.Upload(ctx)
-				if err != nil {
-					log.Println(err)
-				}
-
-				//
-				telegramMessage := &bot.SendMediaGroupParams{
-					ChatID:          cfg.TelegramChatID,
-					MessageThreadID: getMessageThreadId(event.Camera),
-				}
-				ctx := context.Background()
-
-				fileName := frigate.SaveThumbnail(*event)
-				filePathThumbnail, err := os.Open(fileName)
-				if err != nil {
-					log.Fatal(err)
-				}
-				defer filePathThumbnail.Close()
-				defer os.Remove(fileName)
-
-				thumb := &models.InputMediaPhoto{
-					Media:           "attach://" + fileName,
-					MediaAttachment: filePathThumbnail,
-					Caption:         "Ended \n " + s3File.GetPresignedURL(ctx),
-				}
-				medias := []models.InputMedia{
-					thumb,
-				}
-
-				telegramMessage.Media = medias
-				_, err = b.SendMediaGroup(ctx, telegramMessage)
-				if err != nil {
-					log.Println(err)
-				}
-			}
+	clipWorker := pipeline.NewClipWorker(instances, s3Client, b, tracker, alerts)
+	if err := q.Consume(clipWorker.Handle, clipWorker.Dead); err != nil {
+		fatal("Failed to consume queue", err)
+	}
 
-			var sendTelegram = func(filePathClip string) {
-				file, err := os.Open(filePathClip)
-				if err != nil {
-					log.Println(err)
-				}
-				defer file.Close()
+	// Health checks
+	hc := health.New()
+	hc.AddLiveness("queue", func(context.Context) error { return q.Healthy() })
+	hc.AddReadiness("queue", func(context.Context) error { return q.Healthy() })
+	hc.AddReadiness("s3", func(context.Context) error { return s3Client.CheckAlive() })
+	hc.AddReadiness("redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+	hc.AddReadiness("telegram", func(ctx context.Context) error {
+		_, err := b.GetMe(ctx)
+		return err
+	})
+	for _, inst := range instances {
+		name := "frigate"
+		if inst.Name != "" {
+			name += ":" + inst.Name
+		}
+		hc.AddReadiness(name, func(ctx context.Context) error {
+			_, err := inst.Frigate.Version(ctx)
+			return err
+		})
+	}
 
-				telegramMessage := &bot.SendMediaGroupParams{
-					ChatID:          cfg.TelegramChatID,
-					MessageThreadID: getMessageThreadId(event.Camera),
-				}
-				video := &models.InputMediaVideo{
-					MediaAttachment: file,
-					Media:           "attach://" + filePathClip,
-					Caption:         event.Camera + " Event: " + event.Label + ", ID: " + event.ID,
-				}
+	// HTTP server
+	mux := http.NewServeMux()
+	mux.Handle("GET /healthz", hc.LiveHandler())
+	mux.Handle("GET /readyz", hc.ReadyHandler())
+	mux.Handle("GET /events/{id...}", state.HTTPHandler(tracker))
+	mux.Handle("GET /metrics", metrics.Handler())
+	srv := &http.Server{Addr: cfg.HTTPAddr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			fatal("HTTP server stopped", err)
+		}
+	}()
 
-				medias := []models.InputMedia{
-					video,
-				}
+	// Dedupe initialization
+	seen, err := dedupe.New(rdb)
+	if err != nil {
+		fatal("Failed to open dedupe store", err)
+	}
 
-				telegramMessage.Media = medias
-				_, err = b.SendMediaGroup(ctx, telegramMessage)
-				if err != nil {
-					log.Println(err)
-				}
+	// Only the leader polls Frigate, every replica consumes the queue.
+	pollers := make([]pipeline.Poller, 0, len(instances))
+	for _, inst := range instances {
+		switch cfg.FrigateMode {
+		case "events", "":
+			pollers = append(pollers, pipeline.NewPoller(inst, b, seen, q, tracker, hc, alerts))
+		case "reviews":
+			pollers = append(pollers, pipeline.NewReviewPoller(inst, b, seen, q, tracker, hc, alerts))
+		default:
+			fatal("Invalid FRIGATE_MODE", fmt.Errorf("unknown Frigate mode %q", cfg.FrigateMode))
+		}
+	}
+	elector := leader.New(rdb)
+	electorDone := make(chan struct{})
+	go func() {
+		defer close(electorDone)
+		elector.Run(ctx, func(ctx context.Context) {
+			if err := pipeline.Resume(ctx, tracker, q); err != nil {
+				slog.Error("Failed to resume events", "err", err)
 			}
 
+			// Telegram serves getUpdates to one client at a time, and the
+			// webhook to one URL.
+			var wg sync.WaitGroup
+			wg.Add(1)
 			go func() {
-				log.Printf("Received: %s\n", string(msg))
-				time.Sleep(60 * time.Second)
-
-				if event.HasClip {
-					filePathClip := frigate.SaveClip(*event)
-
-					file, err := os.Open(filePathClip)
-					if err != nil {
-						log.Println(err)
-					}
-
-					fileInfo, err := file.Stat()
-					if err != nil {
-						log.Println(err)
-					}
-
-					waitGroup := sync.WaitGroup{}
-
-					if fileInfo.Size() > maxSize {
-						waitGroup.Add(1)
-						go func() {
-							defer waitGroup.Done()
-							sendBucket(filePathClip)
-						}()
-
-					} else {
-						// waitGroup.Add(1)
-						// go func() {
-						// 	defer waitGroup.Done()
-						// 	sendBucket(filePathClip)
-						// }()
-
-						waitGroup.Add(1)
-						go func() {
-							defer waitGroup.Done()
-							sendTelegram(filePathClip)
-						}()
-					}
-
-					waitGroup.Wait()
-
-					defer file.Close()
-					defer os.Remove(filePathClip)
-
+				defer wg.Done()
+				if webhook != nil {
+					leadWebhook(ctx, webhook)
+				} else {
+					b.Start(ctx)
 				}
 			}()
-
-			return nil
+			for _, poller := range pollers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					poller.Run(ctx)
+				}()
+			}
+			wg.Wait()
 		})
 	}()
 
-	// Redis
-	var rdb = redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisAddr,
-		Password: cfg.RedisPassword, // no password set
-		DB:       cfg.RedisDB,       // use default DB
-		Protocol: cfg.RedisProtocol, // specify 2 for RESP 2 or 3 for RESP 3
-	})
+	<-ctx.Done()
+	slog.Info("Shutting down", "timeout", time.Duration(cfg.ShutdownTimeout)*time.Second)
+	shutdown(cfg, electorDone, q, handlers, srv, seen, rdb)
+}
+
+// shutdown waits for the pollers to hand their events to the queue, drains
+// the queue consumers and the bot handlers, then releases everything else,
+// all within SHUTDOWN_TIMEOUT.
+func shutdown(cfg *config.Config, electorDone <-chan struct{}, q queue.Queue, handlers *telegram.InFlight, srv *http.Server, seen dedupe.Store, rdb *redis.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	select {
+	case <-electorDone:
+	case <-ctx.Done():
+		slog.Warn("Pollers did not stop in time")
+	}
+	if err := q.Close(ctx); err != nil {
+		slog.Error("Failed to close queue", "err", err)
+	}
+	if err := handlers.Wait(ctx); err != nil {
+		slog.Warn("Bot handlers did not stop in time", "err", err)
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Failed to stop HTTP server", "err", err)
+	}
+	if err := seen.Close(); err != nil {
+		slog.Error("Failed to close dedupe store", "err", err)
+	}
+	if err := rdb.Close(); err != nil {
+		slog.Error("Failed to close Redis", "err", err)
+	}
+	if err := frigate.RemoveTemp(); err != nil {
+		slog.Error("Failed to remove temporary files", "err", err)
+	}
+	slog.Info("Shutdown complete")
+}
 
-	// Create a go routine channel to send a bot message, when evts is not empty
+// leadWebhook keeps Telegram pointed at the webhook while this replica
+// leads, so that a replica stopping during a rollout doesn't remove the
+// webhook the new leader registered.
+func leadWebhook(ctx context.Context, webhook telegram.Webhook) {
 	for {
-		evts, err = frigate.Events()
-		time.Sleep(200 * time.Millisecond)
-		if err != nil {
-			log.Fatalln(err)
+		err := webhook.Register(ctx)
+		if err == nil {
+			break
 		}
-		if len(evts) > 0 {
-			go func() {
-				for _, x := range evts {
-					if rdb.Get(ctx, x.ID).Val() == x.ID {
-						continue
-					}
-					err = rdb.Set(ctx, x.ID, x.ID, 24*time.Hour).Err()
-
-					rabbit.Publish(ctx, []byte(x.ID))
-
-					//
-
-					telegramMessage := &bot.SendMediaGroupParams{
-						ChatID:          cfg.TelegramChatID,
-						MessageThreadID: getMessageThreadId(x.Camera),
-					}
-					ctx := context.Background()
-
-					//Convert image base64 from x.Thumbnail to image and attach to telegram message
-					fileName := frigate.SaveThumbnail(x)
-					filePathThumbnail, err := os.Open(fileName)
-					if err != nil {
-						log.Fatal(err)
-					}
-					defer filePathThumbnail.Close()
-					defer os.Remove(fileName)
-
-					thumb := &models.InputMediaPhoto{
-						Media:           "attach://" + fileName,
-						MediaAttachment: filePathThumbnail,
-						Caption:         x.Camera + " Event: " + x.Label + ", ID: " + x.ID,
-					}
-					medias := []models.InputMedia{
-						thumb,
-					}
-
-					telegramMessage.Media = medias
-					_, err = b.SendMediaGroup(ctx, telegramMessage)
-					if err != nil {
-						log.Println(err)
-					}
-				}
-			}()
+		slog.Error("Failed to register Telegram webhook", "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(30 * time.Second):
 		}
 	}
+
+	<-ctx.Done()
+	unregisterCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := webhook.Unregister(unregisterCtx); err != nil {
+		slog.Error("Failed to remove Telegram webhook", "err", err)
+	}
 }
 
-func getMessageThreadId(camera string) int {
-	threadList := make(map[string]int)
-	threadList["General"] = 0
-	threadList["Bolacha"] = 2
-	threadList["Rua"] = 3
-	threadList["Tras"] = 4
-	threadList["RuaMAto"] = 5
-	threadList["Portao"] = 26
-	threadList["TrasPorta"] = 366
-	return threadList[camera]
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }